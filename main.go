@@ -1,14 +1,33 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
 
 	"github.com/alecthomas/kingpin"
 	docker "github.com/fsouza/go-dockerclient"
 
 	"github.com/skpr/package/pkg/builder"
+	"github.com/skpr/package/pkg/events"
+	"github.com/skpr/package/pkg/utils/aws/ecr"
+	"github.com/skpr/package/pkg/utils/buildkit"
+	"github.com/skpr/package/pkg/utils/dotenv"
+	"github.com/skpr/package/pkg/utils/git"
+	"github.com/skpr/package/pkg/utils/image"
+	"github.com/skpr/package/pkg/utils/registry"
 )
 
+// Exit code when the build is interrupted by a signal, following the shell convention for SIGINT.
+const exitInterrupted = 130
+
 var (
 	cliDockerUser = kingpin.Flag("docker-username", "Username for Docker authentication").Envar("DOCKER_USERNAME").String()
 	cliDockerPass = kingpin.Flag("docker-password", "Password for Docker authentication").Envar("DOCKER_PASSWORD").String()
@@ -17,28 +36,307 @@ var (
 	cliNoPush     = kingpin.Flag("no-push", "Don't push images to the registry after being built. Used for local debugging.").Bool()
 	cliDirectory  = kingpin.Flag("directory", "The location of the package directory").Default(".skpr/package").String()
 	cliDebug      = kingpin.Flag("debug", "Show debug information").Bool()
-	cliVersion    = kingpin.Arg("version", "Version of the application which is being packaged").Required().String()
+	cliBuildLimit = kingpin.Flag("build-concurrency", "Maximum number of images to build at once").Default(strconv.Itoa(builder.DefaultConcurrency())).Int()
+	cliPushLimit  = kingpin.Flag("push-concurrency", "Maximum number of images to push at once").Default(strconv.Itoa(builder.DefaultConcurrency())).Int()
+	cliProviders  = kingpin.Flag("registry-provider", "Authentication provider (ecr, gar, acr or oauth2) for registries matching a hostname pattern eg. harbor.example.com=oauth2").StringMap()
+	cliAWSProfile = kingpin.Flag("aws-profile", "AWS profile used to authenticate with ECR when no Docker credentials are provided").String()
+	cliAWSRole    = kingpin.Flag("aws-role-arn", "AWS IAM role to assume when authenticating with ECR eg. for a registry in another account").String()
+	cliCreateRepo = kingpin.Flag("create-repository", "Create the ECR repository before pushing if it does not exist").Bool()
+	cliImmutable  = kingpin.Flag("ecr-immutable-tags", "Enable tag immutability when creating an ECR repository").Bool()
+	cliScanOnPush = kingpin.Flag("ecr-scan-on-push", "Enable scan on push when creating an ECR repository").Bool()
+	cliEncryption = kingpin.Flag("ecr-encryption", "Encryption type used when creating an ECR repository").Enum("AES256", "KMS")
+	cliKMSKey     = kingpin.Flag("ecr-kms-key", "KMS key used when creating an ECR repository with KMS encryption").String()
+	cliLifecycle  = kingpin.Flag("ecr-lifecycle-policy", "Path to a JSON lifecycle policy applied when creating an ECR repository").ExistingFile()
+	cliOutFormat  = kingpin.Flag("output-format", "Write the build result in a machine-readable format. Logs are written to stderr when the result is written to stdout").Enum(builder.OutputFormatJSON, builder.OutputFormatYAML)
+	cliOutFile    = kingpin.Flag("output-file", "Write the build result to a file instead of stdout. Defaults to JSON").String()
+	cliTags       = kingpin.Flag("tag", "Additional version to tag each image with eg. latest results in latest-<image>").Strings()
+	cliTagGitSHA  = kingpin.Flag("tag-git-sha", "Tag each image with the abbreviated git commit SHA of the context").Bool()
+	cliNaming     = kingpin.Flag("naming", "Naming preset for images. default results in registry:version-<image>, per-image results in registry/<image>:version").Enum(image.PresetDefault, image.PresetPerImage)
+	cliRepoTmpl   = kingpin.Flag("repository-template", "Template for the repository of each image eg. {{ .Registry }}/{{ .Image }}").String()
+	cliTagTmpl    = kingpin.Flag("tag-template", "Template for the tag of each image eg. {{ .Version }}-{{ .Git.ShortRevision }}").String()
+	cliPlatform   = kingpin.Flag("platform", "Comma separated platforms to build each image for eg. linux/amd64,linux/arm64").String()
+	cliBuildKit   = kingpin.Flag("buildkit", "Build images with BuildKit, which supports secret and SSH mounts").Bool()
+	cliSecrets    = kingpin.Flag("secret", "Secret provided to BuildKit builds eg. id=composer,src=auth.json or id=token,env=TOKEN").Strings()
+	cliCache      = kingpin.Flag("cache", "Reuse layers from the version previously pushed as the cache eg. cache results in cache-<image>. The cache of each pushed image is updated after a successful push").String()
+	cliInline     = kingpin.Flag("inline-cache", "Export cache metadata with each image so later BuildKit builds can reuse its layers").Bool()
+	cliLabels     = kingpin.Flag("label", "Label applied to every image eg. team=platform").StringMap()
+	cliBuildArgs  = kingpin.Flag("build-arg", "Build arg passed to every image eg. KEY=VALUE. Takes precedence over --build-arg-file").StringMap()
+	cliArgFiles   = kingpin.Flag("build-arg-file", "Dotenv file of build args passed to every image. Takes precedence over args declared for an image").ExistingFiles()
+	cliDryRun     = kingpin.Flag("dry-run", "Print the plan for building and pushing the images without contacting the Docker daemon or registry").Bool()
+	cliValidate   = kingpin.Flag("validate-auth", "Resolve registry authentication during a dry run").Bool()
+	cliBuildTime  = kingpin.Flag("build-timeout", "Maximum time to build each image eg. 20m. Unlimited by default").Duration()
+	cliPushTime   = kingpin.Flag("push-timeout", "Maximum time to push each image eg. 10m. Unlimited by default").Duration()
+	cliAttempts   = kingpin.Flag("push-attempts", "Maximum number of attempts to push each image when the registry fails with a transient error").Default(strconv.Itoa(builder.DefaultPushAttempts)).Int()
+	cliRetryDelay = kingpin.Flag("push-retry-delay", "Maximum total time to wait between attempts to push each image").Default(builder.DefaultPushRetryDelay.String()).Duration()
+	cliLogFormat  = kingpin.Flag("log-format", "Format of the build and push logs. github and azure annotate warnings and errors for the CI system").Default(events.FormatText).Enum(events.FormatText, events.FormatJSON, events.FormatGitHub, events.FormatAzure)
+	cliKeepGoing  = kingpin.Flag("keep-going", "Keep building and pushing images which do not depend on an image which failed, then report every failure").Bool()
+	cliTimeout    = kingpin.Flag("timeout", "Maximum time to build and push all images eg. 1h. Unlimited by default").Duration()
+	cliGitVersion = kingpin.Flag("version-from-git", "Derive the version from the context using git describe --tags --always, when a version is not provided").Bool()
+	cliGitDirty   = kingpin.Flag("version-dirty", "Append -dirty to the version derived from git when there are uncommitted changes. Implies --allow-dirty").Bool()
+	cliAllowDirty = kingpin.Flag("allow-dirty", "Warn instead of failing when the version is derived from git and there are uncommitted changes").Bool()
+	cliVersion    = kingpin.Arg("version", "Version of the application which is being packaged. Required unless --version-from-git is set").String()
 )
 
 func main() {
 	kingpin.Parse()
 
+	providers := registry.DefaultProviders()
+
+	// Providers created for user provided patterns share the configuration of the defaults.
+	options := registry.Options{
+		ECR: ecr.Provider{
+			Profile: *cliAWSProfile,
+			RoleARN: *cliAWSRole,
+			Repository: ecr.RepositoryConfig{
+				ImmutableTags:       *cliImmutable,
+				ScanOnPush:          *cliScanOnPush,
+				EncryptionType:      *cliEncryption,
+				KMSKey:              *cliKMSKey,
+				LifecyclePolicyFile: *cliLifecycle,
+			},
+		},
+	}
+
+	providers.Replace(options.ECR)
+
+	// Flags are parsed into a map, so patterns are sorted to match overlapping patterns in a stable order.
+	// Each pattern is prepended, so they are reversed to be matched in ascending order.
+	var patterns []string
+
+	for pattern := range *cliProviders {
+		patterns = append(patterns, pattern)
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(patterns)))
+
+	for _, pattern := range patterns {
+		provider, err := registry.New((*cliProviders)[pattern], options)
+		if err != nil {
+			panic(err)
+		}
+
+		// User provided patterns take precedence over the defaults.
+		err = providers.Prepend(pattern, provider)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// Builds and pushes are cancelled when CI cancels the job.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	format := *cliOutFormat
+	if format == "" && *cliOutFile != "" {
+		format = builder.OutputFormatJSON
+	}
+
+	// Keep stdout clean for the build result.
+	var logs io.Writer = os.Stdout
+	if format != "" && *cliOutFile == "" {
+		logs = os.Stderr
+	}
+
+	renderer, err := events.NewRenderer(*cliLogFormat, logs)
+	if err != nil {
+		panic(err)
+	}
+
+	// Every line of output is rendered in the same format.
+	publisher := events.NewPublisher(ctx, renderer, nil)
+
+	version := *cliVersion
+
+	if version == "" {
+		if !*cliGitVersion {
+			kingpin.Fatalf("required argument 'version' not provided, try --help")
+		}
+
+		v, err := versionFromGit(*cliContext, *cliGitDirty, *cliAllowDirty || *cliGitDirty, publisher)
+		if err != nil {
+			panic(err)
+		}
+
+		version = v
+	}
+
+	// Git information is optional for naming and labels, the context might not be a repository.
+	info, _ := git.Load(*cliContext)
+
+	tags := *cliTags
+
+	if *cliTagGitSHA {
+		if info.ShortRevision == "" {
+			panic("failed to determine the git commit SHA of the context")
+		}
+
+		tags = append(tags, info.ShortRevision)
+	}
+
+	var platforms []string
+
+	for _, platform := range strings.Split(*cliPlatform, ",") {
+		if platform = strings.TrimSpace(platform); platform != "" {
+			platforms = append(platforms, platform)
+		}
+	}
+
+	var secrets []buildkit.Secret
+
+	for _, value := range *cliSecrets {
+		secret, err := buildkit.ParseSecret(value)
+		if err != nil {
+			panic(err)
+		}
+
+		secrets = append(secrets, secret)
+	}
+
+	buildArgs := make(map[string]string)
+
+	// Later files take precedence, followed by the args provided individually.
+	for _, path := range *cliArgFiles {
+		args, err := dotenv.Load(path)
+		if err != nil {
+			panic(err)
+		}
+
+		for key, value := range args {
+			buildArgs[key] = value
+		}
+	}
+
+	for key, value := range *cliBuildArgs {
+		buildArgs[key] = value
+	}
+
 	params := builder.Params{
-		Directory: *cliDirectory,
-		Debug:     *cliDebug,
-		Writer:    os.Stdout,
-		Registry:  *cliRegistry,
-		Version:   *cliVersion,
-		Context:   *cliContext,
-		NoPush:    *cliNoPush,
+		Directory:          *cliDirectory,
+		Debug:              *cliDebug,
+		Writer:             publisher,
+		Registry:           *cliRegistry,
+		Version:            version,
+		Context:            *cliContext,
+		NoPush:             *cliNoPush,
+		BuildConcurrency:   *cliBuildLimit,
+		PushConcurrency:    *cliPushLimit,
+		Providers:          providers,
+		CreateRepository:   *cliCreateRepo,
+		Tags:               tags,
+		NamingPreset:       *cliNaming,
+		RepositoryTemplate: *cliRepoTmpl,
+		TagTemplate:        *cliTagTmpl,
+		Git:                info,
+		Platforms:          platforms,
+		BuildKit:           *cliBuildKit,
+		Secrets:            secrets,
+		CacheVersion:       *cliCache,
+		InlineCache:        *cliInline,
+		Labels:             *cliLabels,
+		BuildArgs:          buildArgs,
+		BuildTimeout:       *cliBuildTime,
+		PushTimeout:        *cliPushTime,
+		Timeout:            *cliTimeout,
+		PushAttempts:       *cliAttempts,
+		PushRetryDelay:     *cliRetryDelay,
+		KeepGoing:          *cliKeepGoing,
 		Auth: docker.AuthConfiguration{
 			Username: *cliDockerUser,
 			Password: *cliDockerPass,
 		},
 	}
 
-	_, err := builder.BuildAndPush(params)
+	if *cliDryRun {
+		plan, err := builder.DryRun(ctx, params, *cliValidate)
+		if err != nil {
+			panic(err)
+		}
+
+		if format == "" {
+			err = plan.Print(os.Stdout)
+		} else {
+			err = writeOutput(plan, format, *cliOutFile)
+		}
+		if err != nil {
+			panic(err)
+		}
+
+		return
+	}
+
+	output, err := builder.BuildAndPush(ctx, params)
+
+	// The result is written even when the build fails, so the status of each image can be inspected.
+	if format != "" {
+		if werr := writeOutput(output, format, *cliOutFile); werr != nil {
+			panic(werr)
+		}
+	}
+
+	if errors.Is(err, context.Canceled) {
+		_ = publisher.Publish(events.Event{Type: events.TypeError, Message: err.Error()})
+		stop()
+		os.Exit(exitInterrupted)
+	}
+
+	// Failures are listed by the error, which a stack trace would only obscure.
+	var failed *builder.BuildError
+	if errors.As(err, &failed) {
+		_ = publisher.Publish(events.Event{Type: events.TypeError, Message: err.Error()})
+		os.Exit(1)
+	}
+
 	if err != nil {
 		panic(err)
 	}
 }
+
+// Encoder of a build result or plan.
+type encoder interface {
+	Encode(w io.Writer, format string) error
+}
+
+// Helper function to write the build result or plan to a file or stdout.
+func writeOutput(output encoder, format, path string) error {
+	if path == "" {
+		return output.Encode(os.Stdout, format)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer f.Close()
+
+	return output.Encode(f, format)
+}
+
+// Helper function to derive a valid image version from git.
+func versionFromGit(dir string, dirtySuffix, allowDirty bool, w io.Writer) (string, error) {
+	dirty, err := git.Dirty(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to derive version from git: %w", err)
+	}
+
+	if dirty {
+		if !allowDirty {
+			return "", fmt.Errorf("refusing to derive version from git because %s has uncommitted changes, use --allow-dirty to continue", dir)
+		}
+
+		fmt.Fprintf(w, "[WARNING] Deriving version from git with uncommitted changes in %s\n", dir)
+	}
+
+	describe, err := git.Describe(dir, dirtySuffix)
+	if err != nil {
+		return "", fmt.Errorf("failed to derive version from git: %w", err)
+	}
+
+	version := image.SanitizeTag(describe)
+	if version == "" {
+		return "", fmt.Errorf("failed to derive version from git: %q is not a valid tag", describe)
+	}
+
+	fmt.Fprintf(w, "Using version from git: %s\n", version)
+
+	return version, nil
+}
@@ -0,0 +1,81 @@
+package builder
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+
+	docker "github.com/fsouza/go-dockerclient"
+
+	"github.com/skpr/package/pkg/utils/manifest"
+)
+
+// Build arg names which are likely to contain secrets.
+var secretArgRegex = regexp.MustCompile(`(?i)(secret|token|passw|key|auth|credential|private)`)
+
+// Helper function to validate that user supplied build args do not override the args provided by the builder.
+func validateBuildArgs(pkg manifest.Manifest, params Params) error {
+	reserved := map[string]bool{
+		BuildArgVersion:     true,
+		BuildArgInlineCache: true,
+	}
+
+	for _, name := range pkg.Names() {
+		reserved[BuildArgImage(name)] = true
+	}
+
+	for key := range params.BuildArgs {
+		if reserved[key] {
+			return fmt.Errorf("build arg %q is reserved", key)
+		}
+	}
+
+	for _, name := range pkg.Names() {
+		for key := range pkg.Images[name].BuildArgs {
+			if reserved[key] {
+				return fmt.Errorf("image %q: build arg %q is reserved", name, key)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Helper function to merge the user supplied build args for an image, in a stable order.
+func userBuildArgs(img manifest.Image, params Params) []docker.BuildArg {
+	merged := make(map[string]string)
+
+	for _, m := range []map[string]string{img.BuildArgs, params.BuildArgs} {
+		for key, value := range m {
+			merged[key] = value
+		}
+	}
+
+	var args []docker.BuildArg
+
+	for _, key := range sortedKeys(merged) {
+		args = append(args, docker.BuildArg{
+			Name:  key,
+			Value: merged[key],
+		})
+	}
+
+	return args
+}
+
+// Helper function to print build args, masking values which look like secrets.
+func printBuildArgs(w io.Writer, args []docker.BuildArg) {
+	for _, arg := range args {
+		fmt.Fprintf(w, "Build arg: %s\n", maskBuildArg(arg))
+	}
+}
+
+// Helper function to format a build arg eg. KEY=VALUE, masking the value if it looks like a secret.
+func maskBuildArg(arg docker.BuildArg) string {
+	value := arg.Value
+	if secretArgRegex.MatchString(arg.Name) && value != "" {
+		value = "********"
+	}
+
+	return fmt.Sprintf("%s=%s", arg.Name, value)
+}
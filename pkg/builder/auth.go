@@ -0,0 +1,105 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+
+	docker "github.com/fsouza/go-dockerclient"
+
+	"github.com/skpr/package/pkg/utils/dockerconfig"
+	"github.com/skpr/package/pkg/utils/registry"
+)
+
+// Helper function to resolve the credentials used to push images.
+//
+// Explicit credentials are upgraded by the registry provider. Otherwise credentials are loaded
+// from the Docker config file eg. from a credential helper, falling back to the registry provider
+// eg. to use an instance profile or metadata server. Credentials from the Docker config file are
+// only upgraded by providers which exchange a login.
+func resolveAuth(ctx context.Context, params Params) (docker.AuthConfiguration, error) {
+	providers := params.Providers
+	if providers == nil {
+		providers = registry.DefaultProviders()
+	}
+
+	provider, ok := providers.Lookup(params.Registry)
+
+	auth := params.Auth
+
+	if auth != (docker.AuthConfiguration{}) {
+		if params.Debug {
+			fmt.Fprintln(params.Writer, "Using registry credentials from the command line")
+		}
+	} else {
+		path, err := dockerconfig.Path()
+		if err != nil {
+			return auth, fmt.Errorf("failed to determine docker config path: %w", err)
+		}
+
+		config, err := dockerconfig.Load(path)
+		if err != nil {
+			return auth, fmt.Errorf("failed to load docker config: %w", err)
+		}
+
+		resolved, source, err := config.Resolve(ctx, registry.Hostname(params.Registry))
+		if err != nil {
+			return auth, fmt.Errorf("failed to resolve credentials from docker config: %w", err)
+		}
+
+		if source != "" {
+			if params.Debug {
+				fmt.Fprintf(params.Writer, "Using registry credentials from %s: %s\n", path, source)
+			}
+
+			if exchanger, exchanges := provider.(registry.Exchanger); !exchanges || !exchanger.ExchangesLogin() {
+				return resolved, nil
+			}
+
+			auth = resolved
+		}
+	}
+
+	if !ok {
+		return auth, nil
+	}
+
+	if params.Debug {
+		fmt.Fprintf(params.Writer, "Using %s registry authentication\n", provider.Name())
+	}
+
+	upgraded, err := providers.Upgrade(ctx, params.Registry, auth)
+	if err != nil {
+		return auth, fmt.Errorf("failed to upgrade registry authentication: %w", err)
+	}
+
+	return upgraded, nil
+}
+
+// Helper function to create a repository being pushed to, if the registry provider supports it.
+func ensureRepository(ctx context.Context, params Params, repository string) error {
+	providers := params.Providers
+	if providers == nil {
+		providers = registry.DefaultProviders()
+	}
+
+	provider, ok := providers.Lookup(repository)
+	if !ok {
+		return fmt.Errorf("no registry provider found for %s", repository)
+	}
+
+	provisioner, ok := provider.(registry.Provisioner)
+	if !ok {
+		return fmt.Errorf("%s registry provider does not support creating repositories", provider.Name())
+	}
+
+	created, err := provisioner.EnsureRepository(ctx, repository, params.Auth)
+	if err != nil {
+		return fmt.Errorf("failed to ensure repository exists: %w", err)
+	}
+
+	if created {
+		fmt.Fprintf(params.Writer, "Created repository: %s\n", repository)
+	}
+
+	return nil
+}
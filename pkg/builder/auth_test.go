@@ -0,0 +1,145 @@
+package builder
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skpr/package/pkg/builder/mock"
+	"github.com/skpr/package/pkg/utils/manifest"
+	"github.com/skpr/package/pkg/utils/registry"
+)
+
+func TestResolveAuth(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", dir)
+
+	err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"auths": {"harbor.example.com": {"auth": "cm9ib3Q6c2VjcmV0"}}}`), 0600)
+	assert.NoError(t, err)
+
+	params := Params{
+		Registry:  "harbor.example.com/project/app",
+		Providers: registry.NewProviders(),
+	}
+
+	auth, err := resolveAuth(context.Background(), params)
+	assert.NoError(t, err)
+	assert.Equal(t, docker.AuthConfiguration{Username: "robot", Password: "secret", ServerAddress: "harbor.example.com"}, auth)
+
+	params.Auth = docker.AuthConfiguration{Username: "user", Password: "pass"}
+
+	auth, err = resolveAuth(context.Background(), params)
+	assert.NoError(t, err)
+	assert.Equal(t, docker.AuthConfiguration{Username: "user", Password: "pass"}, auth)
+}
+
+type mockProvider struct {
+	exchanges bool
+}
+
+func (p mockProvider) Name() string {
+	return "mock"
+}
+
+func (p mockProvider) ExchangesLogin() bool {
+	return p.exchanges
+}
+
+func (p mockProvider) Upgrade(ctx context.Context, registry string, auth docker.AuthConfiguration) (docker.AuthConfiguration, error) {
+	if auth.Username == "" {
+		return docker.AuthConfiguration{Username: "provider", Password: "token"}, nil
+	}
+
+	auth.IdentityToken = "exchanged"
+
+	return auth, nil
+}
+
+func TestResolveAuthProvider(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", dir)
+
+	// The provider obtains credentials when the Docker config has none for the registry.
+	err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"auths": {}}`), 0600)
+	assert.NoError(t, err)
+
+	providers := registry.NewProviders()
+	assert.NoError(t, providers.Register("harbor.example.com", mockProvider{}))
+
+	params := Params{
+		Registry:  "harbor.example.com/project/app",
+		Providers: providers,
+	}
+
+	auth, err := resolveAuth(context.Background(), params)
+	assert.NoError(t, err)
+	assert.Equal(t, docker.AuthConfiguration{Username: "provider", Password: "token"}, auth)
+
+	// Credentials from the Docker config take precedence over those obtained by the provider.
+	err = os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"auths": {"harbor.example.com": {"auth": "cm9ib3Q6c2VjcmV0"}}}`), 0600)
+	assert.NoError(t, err)
+
+	auth, err = resolveAuth(context.Background(), params)
+	assert.NoError(t, err)
+	assert.Equal(t, docker.AuthConfiguration{Username: "robot", Password: "secret", ServerAddress: "harbor.example.com"}, auth)
+
+	// Providers which exchange a login are given the credentials from the Docker config.
+	providers = registry.NewProviders()
+	assert.NoError(t, providers.Register("harbor.example.com", mockProvider{exchanges: true}))
+	params.Providers = providers
+
+	auth, err = resolveAuth(context.Background(), params)
+	assert.NoError(t, err)
+	assert.Equal(t, docker.AuthConfiguration{Username: "robot", Password: "secret", ServerAddress: "harbor.example.com", IdentityToken: "exchanged"}, auth)
+}
+
+func TestAuthenticateCredHelper(t *testing.T) {
+	bin, err := filepath.Abs("../utils/dockerconfig/testdata/bin")
+	assert.NoError(t, err)
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	dir := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", dir)
+
+	// eg. docker-credential-ecr-login, which is used instead of the ECR provider.
+	err = os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"credHelpers": {"123456789012.dkr.ecr.ap-southeast-2.amazonaws.com": "test"}}`), 0600)
+	assert.NoError(t, err)
+
+	dockerClient := &mock.DockerClient{}
+	dockerClient.BuildWg.Add(1)
+	// The image and its cache.
+	dockerClient.PushWg.Add(2)
+
+	push := true
+
+	pkg := manifest.Manifest{
+		Images: map[string]manifest.Image{
+			"compile": {Dockerfile: ".skpr/package/compile/Dockerfile", Push: &push},
+		},
+	}
+
+	var b bytes.Buffer
+
+	params := Params{
+		Writer:       &b,
+		Registry:     "123456789012.dkr.ecr.ap-southeast-2.amazonaws.com/app",
+		Version:      "222",
+		CacheVersion: "cache",
+	}
+
+	builder := NewBuilder(dockerClient)
+
+	_, err = builder.authenticateAndBuild(context.Background(), pkg, params)
+	assert.NoError(t, err)
+
+	auth := docker.AuthConfiguration{Username: "AWS", Password: "ecr", ServerAddress: "123456789012.dkr.ecr.ap-southeast-2.amazonaws.com"}
+
+	// The cache is pulled with the same credentials it is pushed with.
+	assert.Equal(t, []docker.AuthConfiguration{auth}, dockerClient.PullAuths())
+	assert.Equal(t, []docker.AuthConfiguration{auth, auth}, dockerClient.PushAuths())
+}
@@ -2,10 +2,14 @@ package builder
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	docker "github.com/fsouza/go-dockerclient"
@@ -13,20 +17,42 @@ import (
 	"golang.org/x/sync/errgroup"
 
 	"github.com/skpr/package/pkg/color"
-	"github.com/skpr/package/pkg/utils/aws/ecr"
-	"github.com/skpr/package/pkg/utils/finder"
+	"github.com/skpr/package/pkg/events"
+	"github.com/skpr/package/pkg/utils/buildkit"
+	"github.com/skpr/package/pkg/utils/git"
 	"github.com/skpr/package/pkg/utils/image"
+	"github.com/skpr/package/pkg/utils/manifest"
+	"github.com/skpr/package/pkg/utils/registry"
 )
 
 // DockerClientInterface provides an interface that allows us to test the builder.
 type DockerClientInterface interface {
 	BuildImage(options docker.BuildImageOptions) error
 	PushImage(options docker.PushImageOptions, auth docker.AuthConfiguration) error
+	InspectImage(name string) (*docker.Image, error)
+	TagImage(name string, options docker.TagImageOptions) error
+	PullImage(options docker.PullImageOptions, auth docker.AuthConfiguration) error
+}
+
+// RegistryClientInterface provides an interface for registry operations which the Docker API does not support.
+type RegistryClientInterface interface {
+	PushIndex(ctx context.Context, repository, tag string, manifests []registry.IndexManifest, auth docker.AuthConfiguration) (string, error)
+}
+
+// BuildKitClientInterface provides an interface that allows us to test BuildKit builds.
+type BuildKitClientInterface interface {
+	Build(options buildkit.BuildOptions) error
 }
 
 // Builder is the docker image builder.
 type Builder struct {
-	dockerClient DockerClientInterface
+	dockerClient   DockerClientInterface
+	registryClient RegistryClientInterface
+	buildkitClient BuildKitClientInterface
+	// reauthenticate renews registry credentials which expire during a build.
+	reauthenticate func(ctx context.Context) (docker.AuthConfiguration, error)
+	// retryDelay before the first push retry. Defaults to retryInitialDelay.
+	retryDelay time.Duration
 }
 
 // Params used for building the applications.
@@ -39,6 +65,65 @@ type Params struct {
 	Context   string
 	NoPush    bool
 	Auth      docker.AuthConfiguration
+	// BuildConcurrency limits the number of images built at once. Defaults to DefaultConcurrency.
+	BuildConcurrency int
+	// PushConcurrency limits the number of images pushed at once. Defaults to DefaultConcurrency.
+	PushConcurrency int
+	// Providers used to upgrade registry authentication. Defaults to registry.DefaultProviders.
+	Providers *registry.Providers
+	// CreateRepository before pushing if it does not exist.
+	CreateRepository bool
+	// Tags are additional versions each image is tagged with. Tags are evaluated using the tag template
+	// in place of the version eg. "latest" results in "latest-<image>" with the default naming preset.
+	Tags []string
+	// NamingPreset used to name images. See image.NewNaming.
+	NamingPreset string
+	// RepositoryTemplate overrides the repository template of the naming preset.
+	RepositoryTemplate string
+	// TagTemplate overrides the tag template of the naming preset.
+	TagTemplate string
+	// Git information made available to the naming templates.
+	Git git.Info
+	// Platforms each image is built for eg. linux/amd64. Images built for multiple
+	// platforms are pushed as an index referencing an image per platform.
+	Platforms []string
+	// BuildKit is used to build images, which supports secret and SSH mounts.
+	BuildKit bool
+	// Secrets provided to BuildKit builds.
+	Secrets []buildkit.Secret
+	// CacheVersion of the images which layers are reused from eg. "cache" results in "cache-<image>".
+	// The cache is updated once all images have been pushed. Images which are not pushed are not cached.
+	CacheVersion string
+	// InlineCache exports cache metadata with each image so later BuildKit builds can reuse its layers.
+	InlineCache bool
+	// Labels applied to every image, which take precedence over labels declared in the manifest.
+	Labels map[string]string
+	// BuildArgs passed to every image. In order of precedence, images receive:
+	//   - Args provided by the builder eg. SKPR_VERSION and COMPILE_IMAGE, which are reserved.
+	//   - BuildArgs.
+	//   - Args declared for the image in the manifest.
+	//   - Args loaded from the args.env file in the directory of the image.
+	BuildArgs map[string]string
+	// BuildTimeout limits the time taken to build each image. Zero is unlimited.
+	BuildTimeout time.Duration
+	// PushTimeout limits the time taken to push each image. Zero is unlimited.
+	PushTimeout time.Duration
+	// Timeout limits the time taken to build and push all images. Zero is unlimited.
+	Timeout time.Duration
+	// Renderer of the events published during a build. Defaults to plain text written to Writer.
+	// Ignored when Writer is already an events.Publisher.
+	Renderer events.Renderer
+	// Events are also published on this channel, if it is set. The channel must be drained
+	// until the build returns and is not closed by the builder.
+	Events chan<- events.Event
+	// KeepGoing builds and pushes every image which does not depend on an image which failed,
+	// instead of stopping at the first failure. Every failure is reported by a BuildError.
+	KeepGoing bool
+	// PushAttempts made before a push which fails with a transient error eg. a connection reset
+	// or 503 is reported as failed. Defaults to DefaultPushAttempts.
+	PushAttempts int
+	// PushRetryDelay limits the total time spent waiting between push attempts. Defaults to DefaultPushRetryDelay.
+	PushRetryDelay time.Duration
 }
 
 const (
@@ -46,208 +131,765 @@ const (
 	ImageNameCompile = "compile"
 
 	// BuildArgCompileImage is used for referencing the compile image.
+	// Other dependencies are referenced using BuildArgImage.
 	BuildArgCompileImage = "COMPILE_IMAGE"
 	// BuildArgVersion is used for providing the version identifier of the application.
 	BuildArgVersion = "SKPR_VERSION"
+	// BuildArgInlineCache is used for exporting cache metadata with BuildKit.
+	BuildArgInlineCache = "BUILDKIT_INLINE_CACHE"
 )
 
+// DefaultConcurrency used when a build or push limit has not been set.
+func DefaultConcurrency() int {
+	return runtime.NumCPU()
+}
+
+// Helper function to apply the default concurrency.
+func concurrency(limit int) int {
+	if limit < 1 {
+		return DefaultConcurrency()
+	}
+
+	return limit
+}
+
 // NewBuilder creates a new Builder.
 func NewBuilder(dockerClient DockerClientInterface) *Builder {
 	return &Builder{
-		dockerClient: dockerClient,
+		dockerClient:   dockerClient,
+		registryClient: registry.IndexClient{},
+		buildkitClient: buildkit.Client{},
 	}
 }
 
-// BuildOutput provided to tasks which trigger a build.
-type BuildOutput struct {
-	Images map[string]string `json:"image" yaml:"image"`
-}
-
 // BuildAndPush a packaged set of images.
-func BuildAndPush(params Params) (BuildOutput, error) {
+func BuildAndPush(ctx context.Context, params Params) (BuildOutput, error) {
 	var output BuildOutput
 
-	// @todo, Consider abstracting this if another registry + credentials pair is required.
-	if ecr.IsRegistry(params.Registry) {
-		auth, err := ecr.UpgradeAuth(params.Registry, params.Auth)
+	// Every line of output is rendered in the same format, including those written before the build.
+	params = publish(ctx, params)
+
+	pkg, err := loadPackage(params)
+	if err != nil {
+		return output, err
+	}
+
+	// Uses the credentials provided, before they are upgraded for pushing.
+	if params.CreateRepository && !params.NoPush {
+		resolved, err := resolveNames(pkg, params)
+		if err != nil {
+			return output, err
+		}
+
+		for _, repository := range pushRepositories(pkg, resolved) {
+			if err := ensureRepository(ctx, params, repository); err != nil {
+				return output, err
+			}
+		}
+	}
+
+	dockerclient, err := docker.NewClientFromEnv()
+	if err != nil {
+		return output, fmt.Errorf("failed to setup Docker client: %w", err)
+	}
+
+	return NewBuilder(dockerclient).authenticateAndBuild(ctx, pkg, params)
+}
+
+// Helper function to resolve the credentials used to push images, before building them.
+func (b *Builder) authenticateAndBuild(ctx context.Context, pkg manifest.Manifest, params Params) (BuildOutput, error) {
+	// Credentials are only required to push, and are upgraded again from those provided if they expire.
+	if !params.NoPush {
+		provided := params
+
+		auth, err := resolveAuth(ctx, params)
 		if err != nil {
-			return output, fmt.Errorf("failed to upgrade AWS ECR authentication: %w", err)
+			return BuildOutput{}, err
 		}
 
 		params.Auth = auth
+
+		b.reauthenticate = func(ctx context.Context) (docker.AuthConfiguration, error) {
+			return resolveAuth(ctx, provided)
+		}
+	}
+
+	return b.Build(ctx, pkg, params)
+}
+
+// Helper function to publish all output written to the params as events. Output which is
+// already written to a publisher is not published twice.
+func publish(ctx context.Context, params Params) Params {
+	if _, ok := params.Writer.(*events.Publisher); ok {
+		return params
+	}
+
+	renderer := params.Renderer
+	if renderer == nil {
+		renderer = events.Text{Writer: params.Writer}
 	}
 
-	dockerfiles, err := finder.FindDockerfiles(params.Directory)
+	params.Writer = events.NewPublisher(ctx, renderer, params.Events)
+
+	return params
+}
+
+// Helper function to load the package, printing the images which were found.
+func loadPackage(params Params) (manifest.Manifest, error) {
+	pkg, declared, err := manifest.Load(params.Directory, params.Context)
 	if err != nil {
-		return output, fmt.Errorf("failed to find dockerfiles: %w", err)
+		return pkg, fmt.Errorf("failed to load package: %w", err)
 	}
 
 	if params.Debug {
-		fmt.Println("Found the following dockerfiles:")
-		for key, path := range dockerfiles {
-			fmt.Printf("%-10s %q\n", key, path)
+		if declared {
+			fmt.Fprintf(params.Writer, "Loaded the following images from %s:\n", filepath.Join(params.Directory, manifest.Filename))
+		} else {
+			fmt.Fprintln(params.Writer, "Found the following dockerfiles:")
+		}
+		for _, name := range pkg.Names() {
+			fmt.Fprintf(params.Writer, "%-10s %q\n", name, pkg.Images[name].Dockerfile)
 		}
 	}
 
 	// Print deprecation notice.
-	for key, path := range dockerfiles {
-		if strings.HasSuffix(path, ".dockerfile") {
-			fmt.Printf("[DEPRECATED] Dockerfile location %q is deprecated. Use \"%s/%s/Dockerfile\" instead.\n", path, filepath.Dir(path), key)
+	if !declared {
+		for _, name := range pkg.Names() {
+			path := pkg.Images[name].Dockerfile
+			if strings.HasSuffix(path, ".dockerfile") {
+				fmt.Fprintf(params.Writer, "[DEPRECATED] Dockerfile location %q is deprecated. Use \"%s/%s/Dockerfile\" instead.\n", path, filepath.Dir(path), name)
+			}
 		}
 	}
 
-	dockerclient, err := docker.NewClientFromEnv()
-	if err != nil {
-		return output, fmt.Errorf("failed to setup Docker client: %w", err)
-	}
+	return pkg, nil
+}
 
-	builder := NewBuilder(dockerclient)
+// Build the images.
+func (b *Builder) Build(ctx context.Context, pkg manifest.Manifest, params Params) (BuildOutput, error) {
+	// Builds and pushes share the publisher, which decodes their output into events.
+	params = publish(ctx, params)
 
-	output, err = builder.Build(dockerfiles, params)
-	if err != nil {
-		return output, err
+	timings := newTimings()
+
+	resp, err := b.run(ctx, pkg, params, timings)
+
+	// The results are summarised once every build and push has finished, including when one fails.
+	if len(resp.Results) > 0 {
+		timings.apply(resp.Results)
+
+		fmt.Fprintln(params.Writer)
+
+		if err := resp.Summary(params.Writer); err != nil {
+			fmt.Fprintf(params.Writer, "Failed to print summary: %s\n", err)
+		}
 	}
 
-	return output, nil
+	return resp, err
 }
 
-// Build the images.
-func (b *Builder) Build(dockerfiles finder.Dockerfiles, params Params) (BuildOutput, error) {
+// Helper function to build and push the images, recording the timings of each phase.
+func (b *Builder) run(ctx context.Context, pkg manifest.Manifest, params Params, timings *timings) (BuildOutput, error) {
 	resp := BuildOutput{
-		Images: make(map[string]string),
+		Images:  make(map[string]string),
+		Results: make(map[string]ImageOutput),
 	}
 
-	compileDockerfile, ok := dockerfiles[ImageNameCompile]
-	if !ok {
-		return resp, fmt.Errorf("%q is a required dockerfile", ImageNameCompile)
-	}
+	// Results are updated by concurrent builds and pushes.
+	var mu sync.Mutex
 
-	args := []docker.BuildArg{
-		{
-			Name:  BuildArgVersion,
-			Value: params.Version,
-		},
+	update := func(imageName string, fn func(*ImageOutput)) {
+		mu.Lock()
+		defer mu.Unlock()
+		result := resp.Results[imageName]
+		fn(&result)
+		resp.Results[imageName] = result
 	}
 
-	// We build the compile image first, as it is the base image for other images.
-	compileBuild := docker.BuildImageOptions{
-		Name:         image.Name(params.Registry, params.Version, ImageNameCompile),
-		Dockerfile:   compileDockerfile,
-		ContextDir:   params.Context,
-		OutputStream: prefix(params.Writer, ImageNameCompile),
-		BuildArgs:    args,
-	}
+	ctx, cancel := withTimeout(ctx, params.Timeout)
+	defer cancel()
+
+	// Pushes share credentials, so they are only renewed once when they expire.
+	creds := &credentials{auth: params.Auth, renew: b.reauthenticate}
 
-	// We need to build the 'compile' image first.
-	fmt.Fprintf(params.Writer, "Building image: %s\n", compileBuild.Name)
-	start := time.Now()
+	// Images which depend on an image which failed are skipped.
+	t := newTracker(params.KeepGoing)
 
-	err := b.dockerClient.BuildImage(compileBuild)
+	// Validate the package before any builds are started.
+	p, err := prepare(pkg, params)
 	if err != nil {
 		return resp, err
 	}
 
-	fmt.Fprintf(params.Writer, "Built compile image in %s\n", time.Since(start).Round(time.Second))
+	g, resolved, platforms, multiPlatform := p.graph, p.names, p.platforms, p.multiPlatform
 
-	// Remove compile from list of dockerfiles.
-	delete(dockerfiles, ImageNameCompile)
-
-	// Adds compile image identifier to the runtime images as an arg.
-	// That allows runtime images to copy over the compiled code.
-	args = append(args, docker.BuildArg{
-		Name:  BuildArgCompileImage,
-		Value: image.Name(params.Registry, params.Version, ImageNameCompile),
-	})
+	// Images are only referenced once they have been pushed by their primary tag.
+	pushed := func(imageName string) {
+		mu.Lock()
+		defer mu.Unlock()
+		resp.Images[imageName] = resolved[imageName].reference()
+	}
 
-	var builds []docker.BuildImageOptions
+	// Images which failed are reported with their reference, so they can be identified in the summary.
+	failed := func(imageName string) {
+		update(imageName, func(result *ImageOutput) {
+			result.Reference = resolved[imageName].reference()
+			result.Status = failureStatus(ctx)
+		})
+	}
 
-	for imageName, dockerfile := range dockerfiles {
-		builds = append(builds, docker.BuildImageOptions{
-			Name:         image.Name(params.Registry, params.Version, imageName),
-			Dockerfile:   dockerfile,
-			ContextDir:   params.Context,
-			OutputStream: prefix(params.Writer, imageName),
-			BuildArgs:    args,
+	skip := func(imageName string) {
+		t.skip(imageName)
+		update(imageName, func(result *ImageOutput) {
+			result.Reference = resolved[imageName].reference()
+			result.Status = StatusSkipped
 		})
 	}
 
-	bg, ctx := errgroup.WithContext(context.Background())
+	// Images which failed are not pushed, along with the images which depend on them.
+	pushable := func(imageName string) bool {
+		if !t.available(imageName) {
+			return false
+		}
 
-	for _, build := range builds {
-		// https://golang.org/doc/faq#closures_and_goroutines
-		build := build
+		if !t.available(g.requires(imageName)...) {
+			skip(imageName)
+			return false
+		}
 
-		// Allows us to cancel build executions.
-		build.Context = ctx
+		return true
+	}
 
-		fmt.Fprintf(params.Writer, "Building image: %s\n", build.Name)
+	// Closed once an image has been built for a platform or has failed, allowing dependent images to start.
+	built := make(map[string]chan struct{})
+	for _, imageName := range g.order {
+		for _, platform := range platforms {
+			built[platformKey(imageName, platform)] = make(chan struct{})
+		}
+	}
 
-		bg.Go(func() error {
-			start = time.Now()
-			err := b.dockerClient.BuildImage(build)
-			if err != nil {
-				return err
-			}
-			fmt.Fprintf(params.Writer, "Built %s image in %s\n", build.Name, time.Since(start).Round(time.Second))
-			return nil
-		})
+	// Every image built by a run shares the same created timestamp.
+	created := time.Now()
+
+	// Limits the number of builds which run at once. Slots are only acquired once
+	// dependencies are built, so waiting images cannot starve the images they depend on.
+	slots := make(chan struct{}, concurrency(params.BuildConcurrency))
+
+	bg, bctx := errgroup.WithContext(ctx)
+
+	for _, imageName := range g.order {
+		for _, platform := range platforms {
+			// https://golang.org/doc/faq#closures_and_goroutines
+			imageName, platform := imageName, platform
+
+			target := p.platformNames(imageName, platform)
+
+			build := p.buildOptions(imageName, platform, pkg, params, created)
+
+			bg.Go(func() (err error) {
+				defer func() {
+					err = t.fail(ctx, imageName, PhaseBuild, err)
+					close(built[platformKey(imageName, platform)])
+				}()
+
+				for _, dep := range g.dependencies[imageName] {
+					select {
+					case <-built[platformKey(dep, platform)]:
+					case <-bctx.Done():
+						return bctx.Err()
+					}
+				}
+
+				if !t.available(g.dependencies[imageName]...) {
+					skip(imageName)
+					fmt.Fprintf(params.Writer, "Skipping image %s, because an image it depends on failed\n", build.Name)
+					return nil
+				}
+
+				select {
+				case slots <- struct{}{}:
+				case <-bctx.Done():
+					return bctx.Err()
+				}
+
+				// Allows us to cancel build executions.
+				buildCtx, cancel := withTimeout(bctx, params.BuildTimeout)
+				defer cancel()
+
+				build.Context = buildCtx
+
+				// Pulling the cache is part of the build.
+				start := time.Now()
+
+				// Layers are reused from the cache, if it has been pushed previously.
+				if target.cache != "" && b.pullCache(buildCtx, imageName, target, platform, params, creds) {
+					build.CacheFrom = []string{target.cacheReference()}
+				}
+
+				fmt.Fprintf(params.Writer, "Building image: %s\n", build.Name)
+
+				if params.Debug {
+					printBuildArgs(build.OutputStream, build.BuildArgs)
+				}
+
+				err = b.build(build, pkg.Images[imageName], params)
+				<-slots
+				duration := timings.record(imageName, PhaseBuild, start)
+				if err != nil {
+					failed(imageName)
+					return timeoutError(buildCtx, ctx, imageName, PhaseBuild, params.BuildTimeout, params.Timeout, err)
+				}
+				fmt.Fprintf(params.Writer, "Built %s image in %s\n", build.Name, duration.Round(time.Second))
+
+				inspect, err := b.dockerClient.InspectImage(build.Name)
+				if err != nil {
+					failed(imageName)
+					return fmt.Errorf("failed to inspect image %s: %w", build.Name, err)
+				}
+
+				var layers int
+				if inspect.RootFS != nil {
+					layers = len(inspect.RootFS.Layers)
+				}
+
+				// Apply the additional tags, the first tag was applied by the build.
+				// Images built for multiple platforms are only tagged once they are pushed as an index.
+				if !multiPlatform {
+					start = time.Now()
+
+					for _, tag := range target.tags[1:] {
+						err := b.dockerClient.TagImage(build.Name, docker.TagImageOptions{
+							Repo:    target.repository,
+							Tag:     tag,
+							Force:   true,
+							Context: bctx,
+						})
+						if err != nil {
+							failed(imageName)
+							return fmt.Errorf("failed to tag image %s as %s:%s: %w", build.Name, target.repository, tag, err)
+						}
+					}
+
+					timings.record(imageName, phaseTag, start)
+				}
+
+				update(imageName, func(result *ImageOutput) {
+					result.Reference = resolved[imageName].reference()
+					result.Tags = resolved[imageName].tags
+					result.Size += inspect.Size
+					result.Layers += layers
+					if result.Status != StatusFailed && result.Status != StatusInterrupted {
+						result.Status = StatusBuilt
+					}
+					if multiPlatform {
+						result.Platforms = append(result.Platforms, PlatformOutput{
+							Platform:  platform,
+							Reference: build.Name,
+						})
+						sort.Slice(result.Platforms, func(i, j int) bool {
+							return result.Platforms[i].Platform < result.Platforms[j].Platform
+						})
+					}
+				})
+
+				return nil
+			})
+		}
 	}
 	err = bg.Wait()
 	if err != nil {
-		return resp, err
+		return resp, interrupted(ctx, resp, err)
 	}
 
 	if params.NoPush {
-		return resp, nil
+		return resp, t.err(g.order)
 	}
 
-	var pushes []docker.PushImageOptions
-	for imageName := range dockerfiles {
-		// Compile image is only for building, so we don't push.
-		if imageName == ImageNameCompile {
+	pg, pctx := errgroup.WithContext(ctx)
+	pg.SetLimit(concurrency(params.PushConcurrency))
+
+	for _, imageName := range pkg.Names() {
+		if !shouldPush(imageName, pkg.Images[imageName]) {
+			continue
+		}
+
+		// Images are not pushed if they, or an image they depend on, failed.
+		if !pushable(imageName) {
 			continue
 		}
 
-		tag := image.Tag(params.Version, imageName)
+		// Images built for multiple platforms are pushed by their primary platform tag.
+		// The remaining tags are applied by the index.
+		if multiPlatform {
+			for _, platform := range platforms {
+				// https://golang.org/doc/faq#closures_and_goroutines
+				imageName, platform := imageName, platform
+
+				target := p.platformNames(imageName, platform)
+
+				push := docker.PushImageOptions{
+					Name: target.repository,
+					Tag:  target.tags[0],
+				}
+
+				pg.Go(func() error {
+					// Logged once a slot is available, rather than while waiting for one.
+					fmt.Fprintf(params.Writer, "Pushing image: %s:%s\n", push.Name, push.Tag)
+
+					// Allows us to cancel push executions.
+					pushCtx, cancel := withTimeout(pctx, params.PushTimeout)
+					defer cancel()
+
+					push.Context = pushCtx
+
+					var digest string
+
+					start := time.Now()
+					err := b.retry(pushCtx, params, creds, prefix(params.Writer, imageName), func(auth docker.AuthConfiguration) (err error) {
+						digest, err = b.push(push, auth, prefix(params.Writer, imageName))
+						return err
+					})
+					duration := timings.record(imageName, PhasePush, start)
+					update(imageName, func(result *ImageOutput) {
+						if err != nil {
+							result.Status = failureStatus(ctx)
+						}
+						for i := range result.Platforms {
+							if result.Platforms[i].Platform == platform {
+								result.Platforms[i].Digest = digest
+							}
+						}
+					})
+					if err != nil {
+						return t.fail(ctx, imageName, PhasePush, timeoutError(pushCtx, ctx, imageName, PhasePush, params.PushTimeout, params.Timeout, err))
+					}
+					fmt.Fprintf(params.Writer, "Pushed %s:%s image in %s\n", push.Name, push.Tag, duration.Round(time.Second))
+
+					return nil
+				})
+			}
 
-		resp.Images[imageName] = fmt.Sprintf("%s:%s", params.Registry, tag)
+			continue
+		}
 
-		pushes = append(pushes, docker.PushImageOptions{
-			Name: params.Registry,
-			Tag:  tag,
-		})
+		for i, tag := range resolved[imageName].tags {
+			// https://golang.org/doc/faq#closures_and_goroutines
+			imageName := imageName
+			primary := i == 0
+
+			push := docker.PushImageOptions{
+				Name: resolved[imageName].repository,
+				Tag:  tag,
+			}
+
+			pg.Go(func() error {
+				// Logged once a slot is available, rather than while waiting for one.
+				fmt.Fprintf(params.Writer, "Pushing image: %s:%s\n", push.Name, push.Tag)
+
+				// Allows us to cancel push executions.
+				pushCtx, cancel := withTimeout(pctx, params.PushTimeout)
+				defer cancel()
+
+				push.Context = pushCtx
+
+				var digest string
+
+				start := time.Now()
+				err := b.retry(pushCtx, params, creds, prefix(params.Writer, imageName), func(auth docker.AuthConfiguration) (err error) {
+					digest, err = b.push(push, auth, prefix(params.Writer, imageName))
+					return err
+				})
+				duration := timings.record(imageName, PhasePush, start)
+				if err != nil {
+					update(imageName, func(result *ImageOutput) {
+						result.Status = failureStatus(ctx)
+					})
+					return t.fail(ctx, imageName, PhasePush, timeoutError(pushCtx, ctx, imageName, PhasePush, params.PushTimeout, params.Timeout, err))
+				}
+				fmt.Fprintf(params.Writer, "Pushed %s:%s image in %s\n", push.Name, push.Tag, duration.Round(time.Second))
+
+				// Additional tags share the digest of the primary tag.
+				if !primary {
+					return nil
+				}
+
+				// Fallback to the digest the daemon recorded against the image once it has been pushed.
+				if digest == "" {
+					inspect, err := b.dockerClient.InspectImage(fmt.Sprintf("%s:%s", push.Name, push.Tag))
+					if err != nil {
+						return t.fail(ctx, imageName, PhasePush, fmt.Errorf("failed to inspect image %s:%s: %w", push.Name, push.Tag, err))
+					}
+
+					digest = repoDigest(inspect.RepoDigests, push.Name)
+				}
+
+				update(imageName, func(result *ImageOutput) {
+					result.Digest = digest
+					if digest != "" {
+						result.PinnedReference = image.Pinned(push.Name, digest)
+					}
+					if result.Status != StatusFailed && result.Status != StatusInterrupted {
+						result.Status = StatusPushed
+					}
+				})
+
+				pushed(imageName)
+
+				return nil
+			})
+		}
+	}
+	err = pg.Wait()
+	if err != nil {
+		return resp, interrupted(ctx, resp, err)
 	}
 
-	pg, ctx := errgroup.WithContext(context.Background())
+	if multiPlatform {
+		// Indexes reference the images which were pushed for each platform.
+		ig, ictx := errgroup.WithContext(ctx)
+		ig.SetLimit(concurrency(params.PushConcurrency))
 
-	for _, push := range pushes {
-		// https://golang.org/doc/faq#closures_and_goroutines
-		push := push
+		for _, imageName := range pkg.Names() {
+			if !shouldPush(imageName, pkg.Images[imageName]) || !pushable(imageName) {
+				continue
+			}
 
-		// Allows us to cancel push executions.
-		push.Context = ctx
+			var manifests []registry.IndexManifest
 
-		fmt.Fprintf(params.Writer, "Pushing image: %s:%s\n", push.Name, push.Tag)
+			for _, platform := range platforms {
+				manifests = append(manifests, registry.IndexManifest{
+					Tag:      p.platformNames(imageName, platform).tags[0],
+					Platform: platform,
+				})
+			}
 
-		pg.Go(func() error {
-			start = time.Now()
-			err = b.dockerClient.PushImage(push, params.Auth)
-			if err != nil {
-				return err
+			repository := resolved[imageName].repository
+
+			for i, tag := range resolved[imageName].tags {
+				// https://golang.org/doc/faq#closures_and_goroutines
+				imageName, tag := imageName, tag
+				primary := i == 0
+
+				ig.Go(func() error {
+					pushCtx, cancel := withTimeout(ictx, params.PushTimeout)
+					defer cancel()
+
+					var digest string
+
+					start := time.Now()
+					err := b.retry(pushCtx, params, creds, prefix(params.Writer, imageName), func(auth docker.AuthConfiguration) (err error) {
+						digest, err = b.registryClient.PushIndex(pushCtx, repository, tag, manifests, auth)
+						return err
+					})
+					timings.record(imageName, PhasePush, start)
+					if err != nil {
+						update(imageName, func(result *ImageOutput) {
+							result.Status = failureStatus(ctx)
+						})
+						return t.fail(ctx, imageName, PhasePush, timeoutError(pushCtx, ctx, imageName, PhasePush, params.PushTimeout, params.Timeout, err))
+					}
+					fmt.Fprintf(prefix(params.Writer, imageName), "Pushed index %s:%s for %s\n", repository, tag, strings.Join(platforms, ", "))
+
+					if !primary {
+						return nil
+					}
+
+					update(imageName, func(result *ImageOutput) {
+						result.Digest = digest
+						if digest != "" {
+							result.PinnedReference = image.Pinned(repository, digest)
+						}
+						if result.Status != StatusFailed && result.Status != StatusInterrupted {
+							result.Status = StatusPushed
+						}
+					})
+
+					pushed(imageName)
+
+					return nil
+				})
 			}
-			fmt.Fprintf(params.Writer, "Pushed %s:%s image in %s\n", push.Name, push.Tag, time.Since(start).Round(time.Second))
-			return nil
-		})
+		}
+		err = ig.Wait()
+		if err != nil {
+			return resp, interrupted(ctx, resp, err)
+		}
 	}
-	err = pg.Wait()
-	if err != nil {
-		return resp, err
+
+	// The cache is only updated once every image has been pushed.
+	if params.CacheVersion != "" {
+		cg, cctx := errgroup.WithContext(ctx)
+		cg.SetLimit(concurrency(params.PushConcurrency))
+
+		for _, imageName := range g.order {
+			if resolved[imageName].cache == "" || !pushable(imageName) {
+				continue
+			}
+
+			for _, platform := range platforms {
+				// https://golang.org/doc/faq#closures_and_goroutines
+				imageName, platform := imageName, platform
+
+				cg.Go(func() error {
+					pushCtx, cancel := withTimeout(cctx, params.PushTimeout)
+					defer cancel()
+
+					err := b.pushCache(pushCtx, imageName, p.platformNames(imageName, platform), params, creds)
+					if err == nil {
+						return nil
+					}
+
+					// The run was interrupted or timed out.
+					if ctx.Err() != nil {
+						return timeoutError(pushCtx, ctx, imageName, PhasePush, params.PushTimeout, params.Timeout, err)
+					}
+
+					// The images have already been pushed, a stale cache only slows down the next build.
+					fmt.Fprintf(prefix(params.Writer, imageName), "[WARNING] %s\n", err)
+
+					return nil
+				})
+			}
+		}
+
+		err = cg.Wait()
+		if err != nil {
+			return resp, interrupted(ctx, resp, err)
+		}
 	}
 
-	return resp, nil
+	// Images which failed once their primary tag was pushed are not referenced.
+	for imageName := range resp.Images {
+		if !t.available(imageName) {
+			delete(resp.Images, imageName)
+		}
+	}
+
+	return resp, t.err(g.order)
+}
+
+// Helper function to determine the status of an image which failed, because the build was cancelled.
+func failureStatus(ctx context.Context) string {
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return StatusInterrupted
+	}
+
+	return StatusFailed
 }
 
-// Helper function to prefix all output for a stream.
+// Helper function to report the images which were interrupted, if the build was cancelled.
+func interrupted(ctx context.Context, resp BuildOutput, err error) error {
+	if !errors.Is(ctx.Err(), context.Canceled) {
+		return err
+	}
+
+	var images []string
+
+	for name, result := range resp.Results {
+		if result.Status == StatusInterrupted {
+			images = append(images, name)
+		}
+	}
+
+	if len(images) == 0 {
+		return fmt.Errorf("interrupted: %w", ctx.Err())
+	}
+
+	sort.Strings(images)
+
+	return fmt.Errorf("interrupted while processing %s: %w", strings.Join(images, ", "), ctx.Err())
+}
+
+// Helper function to key the build of an image for a platform.
+func platformKey(imageName, platform string) string {
+	return imageName + "@" + platform
+}
+
+// Helper function to assemble the build options for an image.
+func buildOptions(name, reference string, img manifest.Image, params Params, args []docker.BuildArg, labels map[string]string) docker.BuildImageOptions {
+	contextDir := img.Context
+	if contextDir == "" {
+		contextDir = params.Context
+	}
+
+	// User supplied args are declared first, reserved names are validated before any builds are started.
+	buildArgs := append(userBuildArgs(img, params), args...)
+
+	return docker.BuildImageOptions{
+		Name:         reference,
+		Dockerfile:   img.Dockerfile,
+		ContextDir:   contextDir,
+		Target:       img.Target,
+		Labels:       labels,
+		OutputStream: prefix(params.Writer, name),
+		BuildArgs:    buildArgs,
+	}
+}
+
+// Helper function to assemble the labels for an image. Standard OCI labels are applied first,
+// followed by the package labels, the image labels and finally the labels provided by the params.
+func imageLabels(pkgLabels map[string]string, img manifest.Image, params Params, created time.Time) map[string]string {
+	labels := image.Labels(params.Version, params.Git.Revision, params.Git.Source, created)
+
+	for _, m := range []map[string]string{pkgLabels, img.Labels, params.Labels} {
+		for key, value := range m {
+			labels[key] = value
+		}
+	}
+
+	return labels
+}
+
+// Helper function to find the digest for a repository eg. "sha256:..." from "registry@sha256:...".
+func repoDigest(repoDigests []string, repository string) string {
+	for _, repoDigest := range repoDigests {
+		if strings.HasPrefix(repoDigest, repository+"@") {
+			return strings.TrimPrefix(repoDigest, repository+"@")
+		}
+	}
+
+	return ""
+}
+
+// Helper function to determine if an image should be pushed.
+func shouldPush(name string, img manifest.Image) bool {
+	if img.Push != nil {
+		return *img.Push
+	}
+
+	// Compile image is only for building, so we don't push.
+	return name != ImageNameCompile
+}
+
+// Helper function to return the keys of a map in a stable order.
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Helper function to prefix all output for a stream. Output written to a publisher is published as events for the image.
 func prefix(w io.Writer, name string) io.Writer {
+	if publisher, ok := w.(*events.Publisher); ok {
+		return publisher.Image(name)
+	}
+
 	return textio.NewPrefixWriter(w, fmt.Sprintf("%s\t", color.Wrap(strings.ToUpper(name))))
 }
+
+// Helper function to decode the Docker JSON message stream of a phase into events.
+// Output which was not prefixed for an image is rendered as text.
+func decoder(w io.Writer, phase string) *events.Decoder {
+	iw, ok := w.(*events.ImageWriter)
+	if !ok {
+		iw = events.NewPublisher(context.Background(), events.Text{Writer: w}, nil).Image("")
+	}
+
+	return iw.Decoder(phase)
+}
@@ -2,13 +2,24 @@ package builder
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	docker "github.com/fsouza/go-dockerclient"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/skpr/package/pkg/builder/mock"
+	"github.com/skpr/package/pkg/events"
+	"github.com/skpr/package/pkg/utils/buildkit"
 	"github.com/skpr/package/pkg/utils/finder"
+	"github.com/skpr/package/pkg/utils/git"
+	"github.com/skpr/package/pkg/utils/image"
+	"github.com/skpr/package/pkg/utils/manifest"
+	"github.com/skpr/package/pkg/utils/registry"
 )
 
 func TestBuild(t *testing.T) {
@@ -35,10 +46,943 @@ func TestBuild(t *testing.T) {
 	}
 
 	builder := NewBuilder(dockerClient)
-	_, err := builder.Build(dockerFiles, params)
+	_, err := builder.Build(context.Background(), manifest.FromDockerfiles(dockerFiles), params)
 	assert.NoError(t, err)
 
 	assert.Equal(t, 4, dockerClient.BuildCount())
 	assert.Equal(t, 3, dockerClient.PushCount())
 
 }
+
+func TestBuildManifest(t *testing.T) {
+	dockerClient := &mock.DockerClient{}
+	dockerClient.BuildWg.Add(3)
+	dockerClient.PushWg.Add(1)
+
+	noPush := false
+
+	pkg := manifest.Manifest{
+		Images: map[string]manifest.Image{
+			"compile": {Dockerfile: ".skpr/package/compile/Dockerfile"},
+			"app":     {Dockerfile: ".skpr/package/app/Dockerfile"},
+			"debug":   {Dockerfile: ".skpr/package/app/Dockerfile", Target: "debug", Push: &noPush},
+		},
+	}
+
+	var b bytes.Buffer
+
+	params := Params{
+		Writer:   &b,
+		Registry: "foo",
+		Version:  "222",
+		Context:  "bar",
+	}
+
+	builder := NewBuilder(dockerClient)
+	resp, err := builder.Build(context.Background(), pkg, params)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 3, dockerClient.BuildCount())
+	assert.Equal(t, 1, dockerClient.PushCount())
+	assert.Equal(t, map[string]string{"app": "foo:222-app"}, resp.Images)
+
+	assert.Len(t, resp.Results, 3)
+	assert.Equal(t, StatusBuilt, resp.Results["compile"].Status)
+	assert.Equal(t, StatusBuilt, resp.Results["debug"].Status)
+	assert.Equal(t, StatusPushed, resp.Results["app"].Status)
+	assert.Equal(t, "foo:222-app", resp.Results["app"].Reference)
+	assert.NotEmpty(t, resp.Results["app"].Digest)
+	assert.Equal(t, "foo@"+resp.Results["app"].Digest, resp.Results["app"].PinnedReference)
+	assert.NotZero(t, resp.Results["app"].Size)
+	assert.Equal(t, 2, resp.Results["app"].Layers)
+	assert.NotZero(t, resp.Results["app"].Duration)
+	assert.GreaterOrEqual(t, int64(resp.Results["app"].Duration), int64(resp.Results["app"].BuildDuration+resp.Results["app"].PushDuration))
+	assert.Equal(t, resp.Results["compile"].BuildDuration, resp.Results["app"].CompileDuration)
+	assert.Zero(t, resp.Results["compile"].CompileDuration)
+
+	assert.Contains(t, b.String(), "IMAGE    STATUS  DURATION  SIZE  LAYERS")
+}
+
+func TestBuildDependencies(t *testing.T) {
+	dockerClient := &mock.DockerClient{}
+	dockerClient.BuildWg.Add(3)
+
+	pkg := manifest.Manifest{
+		Images: map[string]manifest.Image{
+			"compile": {Dockerfile: ".skpr/package/compile/Dockerfile"},
+			"app":     {Dockerfile: ".skpr/package/app/Dockerfile"},
+			"web":     {Dockerfile: ".skpr/package/web/Dockerfile", Depends: []string{"app"}},
+		},
+	}
+
+	var b bytes.Buffer
+
+	params := Params{
+		Writer:   &b,
+		Registry: "foo",
+		Version:  "222",
+		Context:  "bar",
+		NoPush:   true,
+	}
+
+	builder := NewBuilder(dockerClient)
+	_, err := builder.Build(context.Background(), pkg, params)
+	assert.NoError(t, err)
+
+	builds := dockerClient.Builds()
+	assert.Len(t, builds, 3)
+	assert.Equal(t, "foo:222-compile", builds[0].Name)
+	assert.Equal(t, "foo:222-app", builds[1].Name)
+	assert.Equal(t, "foo:222-web", builds[2].Name)
+
+	assert.Equal(t, []docker.BuildArg{
+		{Name: BuildArgVersion, Value: "222"},
+		{Name: BuildArgCompileImage, Value: "foo:222-compile"},
+		{Name: "APP_IMAGE", Value: "foo:222-app"},
+	}, builds[2].BuildArgs)
+}
+
+func TestBuildConcurrency(t *testing.T) {
+	dockerClient := &mock.DockerClient{Delay: 10 * time.Millisecond}
+	dockerClient.BuildWg.Add(5)
+	dockerClient.PushWg.Add(4)
+
+	pkg := manifest.Manifest{
+		Images: map[string]manifest.Image{
+			"compile": {},
+			"app":     {},
+			"web":     {},
+			"cli":     {},
+			"cron":    {},
+		},
+	}
+
+	var b bytes.Buffer
+
+	params := Params{
+		Writer:           &b,
+		Registry:         "foo",
+		Version:          "222",
+		BuildConcurrency: 2,
+		PushConcurrency:  1,
+	}
+
+	builder := NewBuilder(dockerClient)
+	_, err := builder.Build(context.Background(), pkg, params)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 5, dockerClient.BuildCount())
+	assert.Equal(t, 4, dockerClient.PushCount())
+	assert.Equal(t, 2, dockerClient.MaxActiveBuilds())
+	assert.Equal(t, 1, dockerClient.MaxActivePushes())
+}
+
+func TestBuildTags(t *testing.T) {
+	dockerClient := &mock.DockerClient{}
+	dockerClient.BuildWg.Add(2)
+	dockerClient.PushWg.Add(4)
+
+	pkg := manifest.Manifest{
+		Images: map[string]manifest.Image{
+			"compile": {},
+			"web":     {Tags: []string{"1.4", "latest"}},
+		},
+	}
+
+	var b bytes.Buffer
+
+	params := Params{
+		Writer:   &b,
+		Registry: "foo",
+		Version:  "222",
+		Tags:     []string{"latest", "main"},
+	}
+
+	builder := NewBuilder(dockerClient)
+	resp, err := builder.Build(context.Background(), pkg, params)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, dockerClient.BuildCount())
+	assert.Equal(t, 4, dockerClient.PushCount())
+	assert.ElementsMatch(t, []string{
+		"foo:latest-compile",
+		"foo:main-compile",
+		"foo:latest-web",
+		"foo:main-web",
+		"foo:1.4-web",
+	}, dockerClient.Tags())
+
+	assert.Equal(t, map[string]string{"web": "foo:222-web"}, resp.Images)
+	assert.Equal(t, []string{"222-web", "latest-web", "main-web", "1.4-web"}, resp.Results["web"].Tags)
+	assert.Equal(t, StatusPushed, resp.Results["web"].Status)
+
+	params.Tags = []string{"feature/foo"}
+
+	_, err = builder.Build(context.Background(), pkg, params)
+	assert.EqualError(t, err, `image "compile": invalid tag: feature/foo-compile`)
+}
+
+func TestBuildTagFailure(t *testing.T) {
+	dockerClient := &mock.DockerClient{TagError: errors.New("no such image")}
+	dockerClient.BuildWg.Add(1)
+
+	pkg := manifest.Manifest{
+		Images: map[string]manifest.Image{
+			"compile": {Tags: []string{"latest"}},
+		},
+	}
+
+	var b bytes.Buffer
+
+	params := Params{
+		Writer:   &b,
+		Registry: "foo",
+		Version:  "222",
+	}
+
+	builder := NewBuilder(dockerClient)
+
+	resp, err := builder.Build(context.Background(), pkg, params)
+	assert.EqualError(t, err, "failed to tag image foo:222-compile as foo:latest-compile: no such image")
+	assert.Equal(t, StatusFailed, resp.Results["compile"].Status)
+	assert.Equal(t, "foo:222-compile", resp.Results["compile"].Reference)
+	assert.Contains(t, b.String(), "compile  failed")
+}
+
+func TestBuildNaming(t *testing.T) {
+	dockerClient := &mock.DockerClient{}
+	dockerClient.BuildWg.Add(2)
+	dockerClient.PushWg.Add(2)
+
+	pkg := manifest.Manifest{
+		Naming: manifest.Naming{
+			Preset: image.PresetPerImage,
+		},
+		Images: map[string]manifest.Image{
+			"compile": {Dockerfile: ".skpr/package/compile/Dockerfile"},
+			"web":     {Dockerfile: ".skpr/package/web/Dockerfile"},
+		},
+	}
+
+	var b bytes.Buffer
+
+	params := Params{
+		Writer:   &b,
+		Registry: "foo",
+		Version:  "222",
+		Tags:     []string{"latest"},
+	}
+
+	builder := NewBuilder(dockerClient)
+	resp, err := builder.Build(context.Background(), pkg, params)
+	assert.NoError(t, err)
+
+	assert.Equal(t, map[string]string{"web": "foo/web:222"}, resp.Images)
+	assert.Equal(t, []string{"222", "latest"}, resp.Results["web"].Tags)
+	assert.ElementsMatch(t, []string{"foo/compile:latest", "foo/web:latest"}, dockerClient.Tags())
+
+	for _, build := range dockerClient.Builds() {
+		if build.Name == "foo/web:222" {
+			assert.Contains(t, build.BuildArgs, docker.BuildArg{Name: BuildArgCompileImage, Value: "foo/compile:222"})
+		}
+	}
+
+	// Templates provided by the params take precedence over the manifest.
+	params.TagTemplate = "{{ .Version }}-{{ .Git.ShortRevision }}"
+	params.Git = git.Info{ShortRevision: "abc1234"}
+	params.Tags = nil
+
+	dockerClient.BuildWg.Add(2)
+	dockerClient.PushWg.Add(1)
+
+	resp, err = builder.Build(context.Background(), pkg, params)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"web": "foo/web:222-abc1234"}, resp.Images)
+}
+
+func TestBuildPlatforms(t *testing.T) {
+	dockerClient := &mock.DockerClient{}
+	dockerClient.BuildWg.Add(4)
+	dockerClient.PushWg.Add(2)
+
+	registryClient := &mock.RegistryClient{}
+
+	pkg := manifest.Manifest{
+		Images: map[string]manifest.Image{
+			"compile": {Dockerfile: ".skpr/package/compile/Dockerfile"},
+			"web":     {Dockerfile: ".skpr/package/web/Dockerfile"},
+		},
+	}
+
+	var b bytes.Buffer
+
+	params := Params{
+		Writer:    &b,
+		Registry:  "foo",
+		Version:   "222",
+		Tags:      []string{"latest"},
+		Platforms: []string{"linux/amd64", "linux/arm64"},
+	}
+
+	builder := NewBuilder(dockerClient)
+	builder.registryClient = registryClient
+
+	resp, err := builder.Build(context.Background(), pkg, params)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 4, dockerClient.BuildCount())
+	assert.Equal(t, 2, dockerClient.PushCount())
+
+	// Images are built with the dependency built for the same platform.
+	for _, build := range dockerClient.Builds() {
+		switch build.Name {
+		case "foo:222-web-linux-amd64":
+			assert.Equal(t, "linux/amd64", build.Platform)
+			assert.Contains(t, build.BuildArgs, docker.BuildArg{Name: BuildArgCompileImage, Value: "foo:222-compile-linux-amd64"})
+		case "foo:222-web-linux-arm64":
+			assert.Equal(t, "linux/arm64", build.Platform)
+			assert.Contains(t, build.BuildArgs, docker.BuildArg{Name: BuildArgCompileImage, Value: "foo:222-compile-linux-arm64"})
+		}
+	}
+
+	manifests := []registry.IndexManifest{
+		{Tag: "222-web-linux-amd64", Platform: "linux/amd64"},
+		{Tag: "222-web-linux-arm64", Platform: "linux/arm64"},
+	}
+
+	assert.Equal(t, map[string][]registry.IndexManifest{
+		"foo:222-web":    manifests,
+		"foo:latest-web": manifests,
+	}, registryClient.Indexes())
+
+	assert.Equal(t, map[string]string{"web": "foo:222-web"}, resp.Images)
+	assert.Equal(t, StatusPushed, resp.Results["web"].Status)
+	assert.Equal(t, "foo@"+resp.Results["web"].Digest, resp.Results["web"].PinnedReference)
+	assert.Len(t, resp.Results["web"].Platforms, 2)
+	assert.Equal(t, "foo:222-web-linux-arm64", resp.Results["web"].Platforms[1].Reference)
+	assert.NotEmpty(t, resp.Results["web"].Platforms[1].Digest)
+
+	params.Platforms = []string{"arm64"}
+
+	_, err = builder.Build(context.Background(), pkg, params)
+	assert.EqualError(t, err, "invalid platform: arm64")
+}
+
+func TestBuildBuildKit(t *testing.T) {
+	dockerClient := &mock.DockerClient{}
+	dockerClient.BuildWg.Add(2)
+
+	pkg := manifest.Manifest{
+		Images: map[string]manifest.Image{
+			"compile": {Dockerfile: ".skpr/package/compile/Dockerfile", Secrets: []string{"composer"}, SSH: []string{"default"}},
+			"web":     {Dockerfile: ".skpr/package/web/Dockerfile"},
+		},
+	}
+
+	var b bytes.Buffer
+
+	secrets := []buildkit.Secret{
+		{ID: "composer", Source: "auth.json"},
+		{ID: "token", Env: "TOKEN"},
+	}
+
+	params := Params{
+		Writer:   &b,
+		Registry: "foo",
+		Version:  "222",
+		NoPush:   true,
+		BuildKit: true,
+		Secrets:  secrets,
+	}
+
+	builder := NewBuilder(dockerClient)
+	builder.buildkitClient = dockerClient
+
+	_, err := builder.Build(context.Background(), pkg, params)
+	assert.NoError(t, err)
+
+	builds := make(map[string]buildkit.BuildOptions)
+	for _, build := range dockerClient.BuildKitBuilds() {
+		builds[build.Name] = build
+	}
+
+	assert.Equal(t, []buildkit.Secret{{ID: "composer", Source: "auth.json"}}, builds["foo:222-compile"].Secrets)
+	assert.Equal(t, []string{"default"}, builds["foo:222-compile"].SSH)
+	assert.Empty(t, builds["foo:222-web"].Secrets)
+	assert.Empty(t, builds["foo:222-web"].SSH)
+
+	params.Secrets = secrets[1:]
+
+	_, err = builder.Build(context.Background(), pkg, params)
+	assert.EqualError(t, err, `image "compile" requires secret "composer" which was not provided`)
+
+	params.BuildKit = false
+	params.Secrets = nil
+
+	_, err = builder.Build(context.Background(), pkg, params)
+	assert.EqualError(t, err, `image "compile" uses secrets or SSH which require BuildKit`)
+}
+
+func TestBuildCache(t *testing.T) {
+	dockerClient := &mock.DockerClient{}
+	dockerClient.BuildWg.Add(2)
+	// The web image and its cache. The compile image is not cached, because it is not pushed.
+	dockerClient.PushWg.Add(2)
+
+	pkg := manifest.Manifest{
+		Images: map[string]manifest.Image{
+			"compile": {Dockerfile: ".skpr/package/compile/Dockerfile"},
+			"web":     {Dockerfile: ".skpr/package/web/Dockerfile"},
+		},
+	}
+
+	var b bytes.Buffer
+
+	params := Params{
+		Writer:       &b,
+		Registry:     "foo",
+		Version:      "222",
+		CacheVersion: "cache",
+		InlineCache:  true,
+	}
+
+	builder := NewBuilder(dockerClient)
+
+	_, err := builder.Build(context.Background(), pkg, params)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"foo:cache-web"}, dockerClient.Pulls())
+	assert.Equal(t, 2, dockerClient.PushCount())
+	assert.Equal(t, []string{"foo:cache-web"}, dockerClient.Tags())
+
+	for _, build := range dockerClient.Builds() {
+		if build.Name == "foo:222-web" {
+			assert.Equal(t, []string{"foo:cache-web"}, build.CacheFrom)
+			assert.Contains(t, build.BuildArgs, docker.BuildArg{Name: BuildArgInlineCache, Value: "1"})
+		}
+	}
+
+	// A missing cache does not fail the build.
+	dockerClient = &mock.DockerClient{PullError: &docker.Error{Status: 404, Message: "manifest unknown"}}
+	dockerClient.BuildWg.Add(2)
+	dockerClient.PushWg.Add(2)
+
+	builder = NewBuilder(dockerClient)
+
+	_, err = builder.Build(context.Background(), pkg, params)
+	assert.NoError(t, err)
+
+	for _, build := range dockerClient.Builds() {
+		assert.Empty(t, build.CacheFrom)
+	}
+
+	assert.Contains(t, b.String(), "Skipping cache foo:cache-web")
+	assert.NotContains(t, b.String(), "[WARNING] failed to pull cache")
+
+	// A cache which cannot be pulled for any other reason is a warning.
+	dockerClient = &mock.DockerClient{PullError: &docker.Error{Status: 401, Message: "unauthorized"}}
+	dockerClient.BuildWg.Add(2)
+	dockerClient.PushWg.Add(2)
+
+	builder = NewBuilder(dockerClient)
+
+	_, err = builder.Build(context.Background(), pkg, params)
+	assert.NoError(t, err)
+	assert.Contains(t, b.String(), "[WARNING] failed to pull cache foo:cache-web: API error (401): unauthorized")
+
+	// A cache which cannot be pushed is a warning, because the images have already been pushed.
+	dockerClient = &mock.DockerClient{PushErrors: []error{nil, &docker.Error{Status: 403, Message: "denied"}}}
+	dockerClient.BuildWg.Add(2)
+	dockerClient.PushWg.Add(2)
+
+	builder = NewBuilder(dockerClient)
+
+	resp, err := builder.Build(context.Background(), pkg, params)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusPushed, resp.Results["web"].Status)
+	assert.Contains(t, b.String(), "[WARNING] failed to push cache foo:cache-web: API error (403): denied")
+}
+
+func TestBuildLabels(t *testing.T) {
+	dockerClient := &mock.DockerClient{}
+	dockerClient.BuildWg.Add(2)
+
+	pkg := manifest.Manifest{
+		Labels: map[string]string{
+			"team":  "platform",
+			"owner": "skpr",
+		},
+		Images: map[string]manifest.Image{
+			"compile": {Dockerfile: ".skpr/package/compile/Dockerfile"},
+			"web":     {Dockerfile: ".skpr/package/web/Dockerfile", Labels: map[string]string{"team": "web"}},
+		},
+	}
+
+	var b bytes.Buffer
+
+	params := Params{
+		Writer:   &b,
+		Registry: "foo",
+		Version:  "222",
+		NoPush:   true,
+		Git: git.Info{
+			Revision: "0123456789abcdef",
+			Source:   "https://github.com/skpr/package",
+		},
+		Labels: map[string]string{
+			"owner": "ops",
+		},
+	}
+
+	builder := NewBuilder(dockerClient)
+
+	_, err := builder.Build(context.Background(), pkg, params)
+	assert.NoError(t, err)
+
+	for _, build := range dockerClient.Builds() {
+		assert.Equal(t, "222", build.Labels[image.LabelVersion])
+		assert.Equal(t, "0123456789abcdef", build.Labels[image.LabelRevision])
+		assert.Equal(t, "https://github.com/skpr/package", build.Labels[image.LabelSource])
+		assert.NotEmpty(t, build.Labels[image.LabelCreated])
+		assert.Equal(t, "ops", build.Labels["owner"])
+
+		if build.Name == "foo:222-web" {
+			assert.Equal(t, "web", build.Labels["team"])
+		} else {
+			assert.Equal(t, "platform", build.Labels["team"])
+		}
+	}
+}
+
+func TestBuildArgs(t *testing.T) {
+	dockerClient := &mock.DockerClient{}
+	dockerClient.BuildWg.Add(2)
+
+	pkg := manifest.Manifest{
+		Images: map[string]manifest.Image{
+			"compile": {Dockerfile: ".skpr/package/compile/Dockerfile", BuildArgs: map[string]string{"PHP_VERSION": "8.0", "NODE_ENV": "development"}},
+			"web":     {Dockerfile: ".skpr/package/web/Dockerfile"},
+		},
+	}
+
+	var b bytes.Buffer
+
+	params := Params{
+		Writer:   &b,
+		Registry: "foo",
+		Version:  "222",
+		NoPush:   true,
+		Debug:    true,
+		BuildArgs: map[string]string{
+			"NODE_ENV":       "production",
+			"COMPOSER_TOKEN": "abc123",
+		},
+	}
+
+	builder := NewBuilder(dockerClient)
+
+	_, err := builder.Build(context.Background(), pkg, params)
+	assert.NoError(t, err)
+
+	for _, build := range dockerClient.Builds() {
+		if build.Name == "foo:222-compile" {
+			assert.Equal(t, []docker.BuildArg{
+				{Name: "COMPOSER_TOKEN", Value: "abc123"},
+				{Name: "NODE_ENV", Value: "production"},
+				{Name: "PHP_VERSION", Value: "8.0"},
+				{Name: BuildArgVersion, Value: "222"},
+			}, build.BuildArgs)
+		}
+	}
+
+	assert.Contains(t, b.String(), "Build arg: COMPOSER_TOKEN=********")
+	assert.Contains(t, b.String(), "Build arg: NODE_ENV=production")
+	assert.NotContains(t, b.String(), "abc123")
+
+	params.BuildArgs = map[string]string{BuildArgCompileImage: "alpine"}
+
+	_, err = builder.Build(context.Background(), pkg, params)
+	assert.EqualError(t, err, `build arg "COMPILE_IMAGE" is reserved`)
+
+	params.BuildArgs = nil
+	pkg.Images["web"] = manifest.Image{BuildArgs: map[string]string{BuildArgVersion: "1"}}
+
+	_, err = builder.Build(context.Background(), pkg, params)
+	assert.EqualError(t, err, `image "web": build arg "SKPR_VERSION" is reserved`)
+
+	pkg.Images["web"] = manifest.Image{}
+	params.BuildArgs = map[string]string{BuildArgInlineCache: "0"}
+
+	_, err = builder.Build(context.Background(), pkg, params)
+	assert.EqualError(t, err, `build arg "BUILDKIT_INLINE_CACHE" is reserved`)
+}
+
+func TestBuildInterrupted(t *testing.T) {
+	dockerClient := &mock.DockerClient{Delay: time.Minute}
+	dockerClient.BuildWg.Add(1)
+
+	pkg := manifest.Manifest{
+		Images: map[string]manifest.Image{
+			"compile": {Dockerfile: ".skpr/package/compile/Dockerfile"},
+			"web":     {Dockerfile: ".skpr/package/web/Dockerfile"},
+		},
+	}
+
+	var b bytes.Buffer
+
+	params := Params{
+		Writer:   &b,
+		Registry: "foo",
+		Version:  "222",
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	builder := NewBuilder(dockerClient)
+
+	resp, err := builder.Build(ctx, pkg, params)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.EqualError(t, err, "interrupted while processing compile: context canceled")
+
+	assert.Equal(t, StatusInterrupted, resp.Results["compile"].Status)
+
+	// Images which had not started are not reported.
+	assert.NotContains(t, resp.Results, "web")
+	assert.Equal(t, 1, dockerClient.BuildCount())
+}
+
+func TestBuildTimeout(t *testing.T) {
+	dockerClient := &mock.DockerClient{Delay: time.Minute}
+	dockerClient.BuildWg.Add(1)
+
+	pkg := manifest.Manifest{
+		Images: map[string]manifest.Image{
+			"compile": {Dockerfile: ".skpr/package/compile/Dockerfile"},
+		},
+	}
+
+	var b bytes.Buffer
+
+	params := Params{
+		Writer:       &b,
+		Registry:     "foo",
+		Version:      "222",
+		BuildTimeout: 50 * time.Millisecond,
+		Timeout:      time.Minute,
+	}
+
+	builder := NewBuilder(dockerClient)
+
+	resp, err := builder.Build(context.Background(), pkg, params)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.EqualError(t, err, `build of image "compile" timed out after 50ms`)
+	assert.Equal(t, StatusFailed, resp.Results["compile"].Status)
+
+	// The overall timeout is reported when it is exceeded first.
+	dockerClient.BuildWg.Add(1)
+
+	params.BuildTimeout = time.Minute
+	params.Timeout = 50 * time.Millisecond
+
+	_, err = builder.Build(context.Background(), pkg, params)
+	assert.EqualError(t, err, `build of image "compile" timed out, because the run exceeded its timeout of 50ms`)
+
+	var timeout *TimeoutError
+	assert.ErrorAs(t, err, &timeout)
+	assert.Equal(t, PhaseBuild, timeout.Phase)
+	assert.True(t, timeout.Overall)
+
+	// Pushes are limited separately.
+	dockerClient = &mock.DockerClient{Delay: 200 * time.Millisecond}
+	dockerClient.BuildWg.Add(1)
+	dockerClient.PushWg.Add(1)
+
+	push := true
+	pkg.Images["compile"] = manifest.Image{Dockerfile: ".skpr/package/compile/Dockerfile", Push: &push}
+
+	params.Timeout = 0
+	params.PushTimeout = 20 * time.Millisecond
+
+	builder = NewBuilder(dockerClient)
+
+	_, err = builder.Build(context.Background(), pkg, params)
+	assert.EqualError(t, err, `push of image "compile" timed out after 20ms`)
+}
+
+func TestBuildPushRetry(t *testing.T) {
+	push := true
+
+	pkg := manifest.Manifest{
+		Images: map[string]manifest.Image{
+			"compile": {Dockerfile: ".skpr/package/compile/Dockerfile", Push: &push},
+		},
+	}
+
+	dockerClient := &mock.DockerClient{
+		PushErrors: []error{
+			&docker.Error{Status: 503, Message: "service unavailable"},
+			errors.New("denied: Your authorization token has expired. Reauthenticate and try again."),
+		},
+	}
+	dockerClient.BuildWg.Add(1)
+	dockerClient.PushWg.Add(3)
+
+	var b bytes.Buffer
+
+	params := Params{
+		Writer:   &b,
+		Registry: "foo",
+		Version:  "222",
+		Auth:     docker.AuthConfiguration{Username: "AWS", Password: "expired"},
+	}
+
+	builder := NewBuilder(dockerClient)
+	builder.retryDelay = time.Millisecond
+	builder.reauthenticate = func(ctx context.Context) (docker.AuthConfiguration, error) {
+		return docker.AuthConfiguration{Username: "AWS", Password: "renewed"}, nil
+	}
+
+	resp, err := builder.Build(context.Background(), pkg, params)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusPushed, resp.Results["compile"].Status)
+
+	assert.Equal(t, []docker.AuthConfiguration{
+		{Username: "AWS", Password: "expired"},
+		{Username: "AWS", Password: "expired"},
+		{Username: "AWS", Password: "renewed"},
+	}, dockerClient.PushAuths())
+
+	assert.Contains(t, b.String(), "Push failed (attempt 1 of 3), retrying in")
+	assert.Contains(t, b.String(), "API error (503): service unavailable")
+	assert.Contains(t, b.String(), "Registry credentials have expired, reauthenticating")
+
+	// Pushes fail once the attempts are exhausted.
+	dockerClient = &mock.DockerClient{
+		PushErrors: []error{
+			errors.New("read: connection reset by peer"),
+			errors.New("read: connection reset by peer"),
+		},
+	}
+	dockerClient.BuildWg.Add(1)
+	dockerClient.PushWg.Add(2)
+
+	params.PushAttempts = 2
+
+	builder = NewBuilder(dockerClient)
+	builder.retryDelay = time.Millisecond
+
+	resp, err = builder.Build(context.Background(), pkg, params)
+	assert.EqualError(t, err, "read: connection reset by peer")
+	assert.Equal(t, StatusFailed, resp.Results["compile"].Status)
+	assert.Equal(t, 2, dockerClient.PushCount())
+
+	// Errors which are not transient are not retried.
+	dockerClient = &mock.DockerClient{
+		PushErrors: []error{
+			&docker.Error{Status: 404, Message: "not found"},
+		},
+	}
+	dockerClient.BuildWg.Add(1)
+	dockerClient.PushWg.Add(1)
+
+	builder = NewBuilder(dockerClient)
+	builder.retryDelay = time.Millisecond
+
+	_, err = builder.Build(context.Background(), pkg, params)
+	assert.EqualError(t, err, "API error (404): not found")
+	assert.Equal(t, 1, dockerClient.PushCount())
+}
+
+func TestBuildKeepGoing(t *testing.T) {
+	pkg := manifest.Manifest{
+		Images: map[string]manifest.Image{
+			"compile": {Dockerfile: ".skpr/package/compile/Dockerfile"},
+			"app":     {Dockerfile: ".skpr/package/app/Dockerfile"},
+			"web":     {Dockerfile: ".skpr/package/web/Dockerfile", Depends: []string{"app"}},
+			"cli":     {Dockerfile: ".skpr/package/cli/Dockerfile"},
+			"cron":    {Dockerfile: ".skpr/package/cron/Dockerfile"},
+		},
+	}
+
+	dockerClient := &mock.DockerClient{
+		BuildErrors: map[string]error{
+			"foo:222-app": errors.New("failed to parse Dockerfile"),
+			"foo:222-cli": errors.New("failed to parse Dockerfile"),
+		},
+		PushErrors: []error{
+			&docker.Error{Status: 403, Message: "denied"},
+		},
+	}
+	// The web image is skipped, because the app image failed.
+	dockerClient.BuildWg.Add(4)
+	dockerClient.PushWg.Add(1)
+
+	var b bytes.Buffer
+
+	params := Params{
+		Writer:    &b,
+		Registry:  "foo",
+		Version:   "222",
+		KeepGoing: true,
+	}
+
+	builder := NewBuilder(dockerClient)
+
+	resp, err := builder.Build(context.Background(), pkg, params)
+	assert.EqualError(t, err, `3 of the images failed:
+  app (build): failed to parse Dockerfile
+  cli (build): failed to parse Dockerfile
+  cron (push): API error (403): denied
+skipped images which depend on them: web`)
+
+	var buildErr *BuildError
+	assert.ErrorAs(t, err, &buildErr)
+	assert.Equal(t, []string{"web"}, buildErr.Skipped)
+	assert.Equal(t, PhasePush, buildErr.Failures[2].Phase)
+
+	assert.Equal(t, 4, dockerClient.BuildCount())
+	assert.Equal(t, 1, dockerClient.PushCount())
+
+	assert.Equal(t, StatusBuilt, resp.Results["compile"].Status)
+	assert.Equal(t, StatusFailed, resp.Results["app"].Status)
+	assert.Equal(t, StatusSkipped, resp.Results["web"].Status)
+	assert.Equal(t, StatusFailed, resp.Results["cli"].Status)
+	assert.Equal(t, StatusFailed, resp.Results["cron"].Status)
+	assert.Equal(t, map[string]string{}, resp.Images)
+
+	// Without keeping going, the first failure is returned.
+	dockerClient = &mock.DockerClient{
+		BuildErrors: map[string]error{
+			"foo:222-compile": errors.New("failed to parse Dockerfile"),
+		},
+	}
+	dockerClient.BuildWg.Add(1)
+
+	params.KeepGoing = false
+
+	builder = NewBuilder(dockerClient)
+
+	_, err = builder.Build(context.Background(), pkg, params)
+	assert.EqualError(t, err, "failed to parse Dockerfile")
+	assert.Equal(t, 1, dockerClient.BuildCount())
+}
+
+func TestBuildPushFailure(t *testing.T) {
+	dockerClient := &mock.DockerClient{
+		PushErrors: []error{
+			&docker.Error{Status: 403, Message: "denied"},
+		},
+	}
+	dockerClient.BuildWg.Add(2)
+	dockerClient.PushWg.Add(1)
+
+	pkg := manifest.Manifest{
+		Images: map[string]manifest.Image{
+			"compile": {Dockerfile: ".skpr/package/compile/Dockerfile"},
+			"app":     {Dockerfile: ".skpr/package/app/Dockerfile"},
+		},
+	}
+
+	var b bytes.Buffer
+
+	params := Params{
+		Writer:   &b,
+		Registry: "foo",
+		Version:  "222",
+	}
+
+	builder := NewBuilder(dockerClient)
+
+	// Images which failed to push are not referenced.
+	resp, err := builder.Build(context.Background(), pkg, params)
+	assert.EqualError(t, err, "API error (403): denied")
+	assert.Empty(t, resp.Images)
+	assert.Equal(t, StatusFailed, resp.Results["app"].Status)
+}
+
+func TestBuildEvents(t *testing.T) {
+	push := true
+
+	pkg := manifest.Manifest{
+		Images: map[string]manifest.Image{
+			"compile": {Dockerfile: ".skpr/package/compile/Dockerfile", Push: &push},
+		},
+	}
+
+	dockerClient := &mock.DockerClient{}
+	dockerClient.BuildWg.Add(1)
+	dockerClient.PushWg.Add(1)
+
+	var b bytes.Buffer
+
+	channel := make(chan events.Event, 100)
+
+	params := Params{
+		Writer:   &b,
+		Registry: "foo",
+		Version:  "222",
+		Renderer: events.JSON{Writer: &b},
+		Events:   channel,
+	}
+
+	_, err := NewBuilder(dockerClient).Build(context.Background(), pkg, params)
+	assert.NoError(t, err)
+
+	close(channel)
+
+	var published []events.Event
+
+	for event := range channel {
+		published = append(published, event)
+	}
+
+	assert.Equal(t, events.TypeLog, published[0].Type)
+	assert.Equal(t, "Building image: foo:222-compile", published[0].Message)
+
+	var status []events.Event
+
+	for _, event := range published {
+		if event.Type == events.TypeStatus {
+			status = append(status, event)
+		}
+	}
+
+	assert.Len(t, status, 1)
+	assert.Equal(t, "compile", status[0].Image)
+	assert.Equal(t, PhasePush, status[0].Phase)
+
+	// Every event is rendered as a JSON line.
+	assert.Len(t, strings.Split(strings.TrimSpace(b.String()), "\n"), len(published))
+}
+
+func TestPublish(t *testing.T) {
+	var b bytes.Buffer
+
+	params := Params{
+		Directory: "../utils/manifest/testdata/manifest",
+		Context:   "../utils/manifest/testdata/manifest",
+		Debug:     true,
+		Writer:    &b,
+		Registry:  "foo",
+		Version:   "222",
+		NoPush:    true,
+		Renderer:  events.JSON{Writer: &b},
+	}
+
+	published := publish(context.Background(), params)
+
+	// Output is only published once.
+	assert.Same(t, published.Writer, publish(context.Background(), published).Writer)
+
+	// Output written before the build is rendered in the same format.
+	_, err := DryRun(context.Background(), params, false)
+	assert.NoError(t, err)
+
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		var event events.Event
+		assert.NoError(t, json.Unmarshal([]byte(line), &event), line)
+	}
+
+	assert.Contains(t, b.String(), "Loaded the following images")
+}
@@ -0,0 +1,82 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+
+	docker "github.com/fsouza/go-dockerclient"
+
+	"github.com/skpr/package/pkg/utils/buildkit"
+	"github.com/skpr/package/pkg/utils/manifest"
+)
+
+// Helper function to build an image using the backend selected by the params.
+func (b *Builder) build(options docker.BuildImageOptions, img manifest.Image, params Params) error {
+	if !params.BuildKit {
+		stream := decoder(options.OutputStream, PhaseBuild)
+
+		options.OutputStream = stream
+		options.RawJSONStream = true
+
+		err := b.dockerClient.BuildImage(options)
+		if cerr := stream.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+
+		return stream.Err()
+	}
+
+	return b.buildkitClient.Build(buildkit.BuildOptions{
+		BuildImageOptions: options,
+		Secrets:           imageSecrets(img, params.Secrets),
+		SSH:               img.SSH,
+	})
+}
+
+// Helper function to validate that the secrets and SSH agents used by images can be provided.
+func validateBuildKit(pkg manifest.Manifest, params Params) error {
+	provided := make(map[string]bool)
+
+	for _, secret := range params.Secrets {
+		provided[secret.ID] = true
+	}
+
+	if !params.BuildKit && len(params.Secrets) > 0 {
+		return errors.New("secrets require BuildKit")
+	}
+
+	for _, name := range pkg.Names() {
+		img := pkg.Images[name]
+
+		if !params.BuildKit && (len(img.Secrets) > 0 || len(img.SSH) > 0) {
+			return fmt.Errorf("image %q uses secrets or SSH which require BuildKit", name)
+		}
+
+		for _, id := range img.Secrets {
+			if !provided[id] {
+				return fmt.Errorf("image %q requires secret %q which was not provided", name, id)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Helper function to return the secrets which are mounted into an image.
+// Only the secrets declared by the image are mounted, so an image which declares none receives none.
+func imageSecrets(img manifest.Image, secrets []buildkit.Secret) []buildkit.Secret {
+	var filtered []buildkit.Secret
+
+	for _, secret := range secrets {
+		for _, id := range img.Secrets {
+			if secret.ID == id {
+				filtered = append(filtered, secret)
+			}
+		}
+	}
+
+	return filtered
+}
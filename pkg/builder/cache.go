@@ -0,0 +1,88 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// Caches which have not been pushed yet, as reported by the daemon or relayed from the registry.
+var missingCacheRegex = regexp.MustCompile(`(?i)(manifest unknown|manifest for \S+ not found|no such image)`)
+
+// Helper function to pull the cache for an image, returning true if it can be used.
+// A cache which has not been pushed yet is skipped. A cache which cannot be pulled for
+// any other reason eg. the credentials were denied is skipped with a warning.
+func (b *Builder) pullCache(ctx context.Context, imageName string, target names, platform string, params Params, creds *credentials) bool {
+	w := prefix(params.Writer, imageName)
+
+	err := b.dockerClient.PullImage(docker.PullImageOptions{
+		Repository:   target.repository,
+		Tag:          target.cache,
+		Platform:     platform,
+		OutputStream: w,
+		Context:      ctx,
+	}, creds.get())
+	if err == nil {
+		return true
+	}
+
+	if missingCache(err) {
+		fmt.Fprintf(w, "Skipping cache %s: %s\n", target.cacheReference(), err)
+	} else {
+		fmt.Fprintf(w, "[WARNING] failed to pull cache %s: %s\n", target.cacheReference(), err)
+	}
+
+	return false
+}
+
+// Helper function to determine whether a cache could not be pulled because it has not been pushed yet.
+func missingCache(err error) bool {
+	if errors.Is(err, docker.ErrNoSuchImage) {
+		return true
+	}
+
+	var dockerErr *docker.Error
+	if errors.As(err, &dockerErr) && dockerErr.Status == http.StatusNotFound {
+		return true
+	}
+
+	return missingCacheRegex.MatchString(err.Error())
+}
+
+// Helper function to tag an image with its cache tag and push it, so the next build can reuse its layers.
+func (b *Builder) pushCache(ctx context.Context, imageName string, target names, params Params, creds *credentials) error {
+	err := b.dockerClient.TagImage(target.reference(), docker.TagImageOptions{
+		Repo:    target.repository,
+		Tag:     target.cache,
+		Force:   true,
+		Context: ctx,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to tag image %s as %s: %w", target.reference(), target.cacheReference(), err)
+	}
+
+	start := time.Now()
+
+	w := prefix(params.Writer, imageName)
+
+	err = b.retry(ctx, params, creds, w, func(auth docker.AuthConfiguration) error {
+		_, err := b.push(docker.PushImageOptions{
+			Name:    target.repository,
+			Tag:     target.cache,
+			Context: ctx,
+		}, auth, w)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to push cache %s: %w", target.cacheReference(), err)
+	}
+
+	fmt.Fprintf(params.Writer, "Pushed cache %s in %s\n", target.cacheReference(), time.Since(start).Round(time.Second))
+
+	return nil
+}
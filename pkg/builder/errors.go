@@ -0,0 +1,243 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// PhaseBuild is the phase where an image is built.
+	PhaseBuild = "build"
+	// PhasePush is the phase where an image is pushed.
+	PhasePush = "push"
+)
+
+// TimeoutError is returned when a phase of an image takes longer than allowed.
+type TimeoutError struct {
+	// Image which timed out.
+	Image string
+	// Phase which timed out eg. push.
+	Phase string
+	// Timeout which was exceeded.
+	Timeout time.Duration
+	// Overall is true when the timeout of the whole run was exceeded, rather than the timeout of the phase.
+	Overall bool
+}
+
+// Error implements the error interface.
+func (e *TimeoutError) Error() string {
+	// The deadline was set by the caller.
+	if e.Timeout == 0 {
+		return fmt.Sprintf("%s of image %q timed out", e.Phase, e.Image)
+	}
+
+	if e.Overall {
+		return fmt.Sprintf("%s of image %q timed out, because the run exceeded its timeout of %s", e.Phase, e.Image, e.Timeout)
+	}
+
+	return fmt.Sprintf("%s of image %q timed out after %s", e.Phase, e.Image, e.Timeout)
+}
+
+// Unwrap allows the error to be identified as a deadline being exceeded.
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// Helper function to limit an operation to a timeout. A timeout of zero is unlimited.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// Helper function to name the image and phase which timed out, if an error was caused by a timeout.
+// The run context identifies when the overall timeout was exceeded, rather than the timeout of the phase.
+func timeoutError(ctx, run context.Context, imageName, phase string, timeout, overall time.Duration, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+
+	if errors.Is(run.Err(), context.DeadlineExceeded) {
+		return &TimeoutError{
+			Image:   imageName,
+			Phase:   phase,
+			Timeout: overall,
+			Overall: true,
+		}
+	}
+
+	return &TimeoutError{
+		Image:   imageName,
+		Phase:   phase,
+		Timeout: timeout,
+	}
+}
+
+// Failure of a single image during a phase.
+type Failure struct {
+	// Image which failed.
+	Image string
+	// Phase which failed eg. build.
+	Phase string
+	// Err which caused the failure.
+	Err error
+}
+
+// Error implements the error interface.
+func (f Failure) Error() string {
+	return fmt.Sprintf("%s of image %q failed: %s", f.Phase, f.Image, f.Err)
+}
+
+// Unwrap allows the cause of the failure to be identified.
+func (f Failure) Unwrap() error {
+	return f.Err
+}
+
+// BuildError is returned when images fail while keeping going, listing every failure.
+type BuildError struct {
+	// Failures in the order the images are built.
+	Failures []Failure
+	// Skipped images, which were not built or pushed because an image they depend on failed.
+	Skipped []string
+}
+
+// Error implements the error interface.
+func (e *BuildError) Error() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%d of the images failed:", len(e.Failures))
+
+	for _, failure := range e.Failures {
+		fmt.Fprintf(&b, "\n  %s (%s): %s", failure.Image, failure.Phase, failure.Err)
+	}
+
+	if len(e.Skipped) > 0 {
+		fmt.Fprintf(&b, "\nskipped images which depend on them: %s", strings.Join(e.Skipped, ", "))
+	}
+
+	return b.String()
+}
+
+// tracker records the images which failed, so the images which depend on them can be skipped.
+type tracker struct {
+	mu sync.Mutex
+	// keepGoing once an image fails, instead of stopping the run.
+	keepGoing   bool
+	failures    []Failure
+	skipped     map[string]bool
+	unavailable map[string]bool
+}
+
+// Helper function to create a tracker.
+func newTracker(keepGoing bool) *tracker {
+	return &tracker{
+		keepGoing:   keepGoing,
+		skipped:     make(map[string]bool),
+		unavailable: make(map[string]bool),
+	}
+}
+
+// Helper function to record an image which failed. Returns the error if the run should stop,
+// which is always the case once the run has been cancelled.
+func (t *tracker) fail(ctx context.Context, imageName, phase string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.unavailable[imageName] = true
+
+	if !t.keepGoing || errors.Is(ctx.Err(), context.Canceled) {
+		return err
+	}
+
+	// Only the first failure of each phase is reported eg. when multiple tags fail to push.
+	for _, failure := range t.failures {
+		if failure.Image == imageName && failure.Phase == phase {
+			return nil
+		}
+	}
+
+	t.failures = append(t.failures, Failure{
+		Image: imageName,
+		Phase: phase,
+		Err:   err,
+	})
+
+	return nil
+}
+
+// Helper function to record an image which was skipped because an image it depends on failed.
+func (t *tracker) skip(imageName string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.unavailable[imageName] = true
+	t.skipped[imageName] = true
+}
+
+// Helper function to determine if none of the images have failed or been skipped.
+func (t *tracker) available(imageNames ...string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, imageName := range imageNames {
+		if t.unavailable[imageName] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Helper function to report the failures, in the order the images are built.
+func (t *tracker) err(order []string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.failures) == 0 {
+		return nil
+	}
+
+	position := make(map[string]int)
+	for i, imageName := range order {
+		position[imageName] = i
+	}
+
+	failures := append([]Failure(nil), t.failures...)
+
+	sort.SliceStable(failures, func(i, j int) bool {
+		if position[failures[i].Image] != position[failures[j].Image] {
+			return position[failures[i].Image] < position[failures[j].Image]
+		}
+
+		// Builds come before pushes.
+		return failures[i].Phase < failures[j].Phase
+	})
+
+	var skipped []string
+
+	for _, imageName := range order {
+		if t.skipped[imageName] {
+			skipped = append(skipped, imageName)
+		}
+	}
+
+	return &BuildError{
+		Failures: failures,
+		Skipped:  skipped,
+	}
+}
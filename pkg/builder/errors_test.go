@@ -0,0 +1,25 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeoutError(t *testing.T) {
+	run := context.Background()
+
+	expired, cancel := context.WithDeadline(run, time.Now())
+	defer cancel()
+
+	assert.NoError(t, timeoutError(run, run, "app", PhasePush, time.Minute, time.Hour, nil))
+
+	err := errors.New("failed")
+	assert.Equal(t, err, timeoutError(run, run, "app", PhasePush, time.Minute, time.Hour, err))
+
+	assert.EqualError(t, timeoutError(expired, run, "app", PhasePush, time.Minute, time.Hour, err), `push of image "app" timed out after 1m0s`)
+	assert.EqualError(t, timeoutError(expired, expired, "app", PhasePush, time.Minute, time.Hour, err), `push of image "app" timed out, because the run exceeded its timeout of 1h0m0s`)
+}
@@ -0,0 +1,133 @@
+package builder
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/skpr/package/pkg/utils/manifest"
+)
+
+// graph of build dependencies between images.
+type graph struct {
+	// order in which images can be built sequentially.
+	order []string
+	// dependencies of each image.
+	dependencies map[string][]string
+}
+
+// Used to convert an image name into a build arg name.
+var buildArgInvalid = regexp.MustCompile(`[^A-Z0-9_]+`)
+
+// BuildArgImage returns the build arg used to reference a dependency image eg. "COMPILE_IMAGE".
+func BuildArgImage(name string) string {
+	return fmt.Sprintf("%s_IMAGE", buildArgInvalid.ReplaceAllString(strings.ToUpper(name), "_"))
+}
+
+// Helper function to resolve the dependency graph of a package.
+// Every image depends on the compile image, along with the images it declares.
+func newGraph(pkg manifest.Manifest) (graph, error) {
+	g := graph{
+		dependencies: make(map[string][]string),
+	}
+
+	// Images are passed to their dependents as build args, so their names cannot collide eg. "node-assets" and "node_assets".
+	args := make(map[string]string)
+
+	for _, name := range pkg.Names() {
+		arg := BuildArgImage(name)
+
+		if existing, ok := args[arg]; ok {
+			return g, fmt.Errorf("images %q and %q share the build arg %s", existing, name, arg)
+		}
+
+		args[arg] = name
+	}
+
+	for _, name := range pkg.Names() {
+		var deps []string
+
+		if name != ImageNameCompile {
+			deps = append(deps, ImageNameCompile)
+		}
+
+		for _, dep := range pkg.Images[name].Depends {
+			if _, ok := pkg.Images[dep]; !ok {
+				return g, fmt.Errorf("image %q depends on %q which does not exist", name, dep)
+			}
+
+			if dep == ImageNameCompile {
+				continue
+			}
+
+			deps = append(deps, dep)
+		}
+
+		g.dependencies[name] = deps
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make(map[string]int)
+
+	var visit func(name string, path []string) error
+
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("dependency cycle detected: %s", strings.Join(append(path, name), " -> "))
+		}
+
+		state[name] = visiting
+
+		for _, dep := range g.dependencies[name] {
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+
+		state[name] = visited
+		g.order = append(g.order, name)
+
+		return nil
+	}
+
+	for _, name := range pkg.Names() {
+		if err := visit(name, nil); err != nil {
+			return g, err
+		}
+	}
+
+	return g, nil
+}
+
+// Helper function to list every image an image depends on, directly or indirectly.
+func (g graph) requires(name string) []string {
+	var (
+		required []string
+		seen     = make(map[string]bool)
+		visit    func(name string)
+	)
+
+	visit = func(name string) {
+		for _, dep := range g.dependencies[name] {
+			if seen[dep] {
+				continue
+			}
+
+			seen[dep] = true
+			required = append(required, dep)
+			visit(dep)
+		}
+	}
+
+	visit(name)
+
+	return required
+}
@@ -0,0 +1,75 @@
+package builder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skpr/package/pkg/utils/manifest"
+)
+
+func TestNewGraph(t *testing.T) {
+	pkg := manifest.Manifest{
+		Images: map[string]manifest.Image{
+			"compile": {},
+			"app":     {},
+			"web":     {Depends: []string{"app"}},
+			"cli":     {},
+			"cron":    {Depends: []string{"cli", "compile"}},
+		},
+	}
+
+	g, err := newGraph(pkg)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"compile", "app", "cli", "cron", "web"}, g.order)
+	assert.Empty(t, g.dependencies["compile"])
+	assert.Equal(t, []string{"compile", "app"}, g.dependencies["web"])
+	assert.Equal(t, []string{"compile", "cli"}, g.dependencies["cron"])
+
+	assert.Empty(t, g.requires("compile"))
+	assert.Equal(t, []string{"compile", "app"}, g.requires("web"))
+}
+
+func TestNewGraphMissing(t *testing.T) {
+	pkg := manifest.Manifest{
+		Images: map[string]manifest.Image{
+			"compile": {},
+			"web":     {Depends: []string{"app"}},
+		},
+	}
+
+	_, err := newGraph(pkg)
+	assert.EqualError(t, err, `image "web" depends on "app" which does not exist`)
+}
+
+func TestNewGraphCycle(t *testing.T) {
+	pkg := manifest.Manifest{
+		Images: map[string]manifest.Image{
+			"compile": {},
+			"app":     {Depends: []string{"web"}},
+			"web":     {Depends: []string{"app"}},
+		},
+	}
+
+	_, err := newGraph(pkg)
+	assert.EqualError(t, err, "dependency cycle detected: app -> web -> app")
+}
+
+func TestNewGraphBuildArgCollision(t *testing.T) {
+	pkg := manifest.Manifest{
+		Images: map[string]manifest.Image{
+			"compile":     {},
+			"node-assets": {},
+			"node_assets": {},
+		},
+	}
+
+	_, err := newGraph(pkg)
+	assert.EqualError(t, err, `images "node-assets" and "node_assets" share the build arg NODE_ASSETS_IMAGE`)
+}
+
+func TestBuildArgImage(t *testing.T) {
+	assert.Equal(t, "COMPILE_IMAGE", BuildArgImage("compile"))
+	assert.Equal(t, "NODE_ASSETS_IMAGE", BuildArgImage("node-assets"))
+}
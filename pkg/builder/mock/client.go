@@ -1,41 +1,238 @@
 package mock
 
 import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
 	"sync"
+	"time"
 
 	docker "github.com/fsouza/go-dockerclient"
+
+	"github.com/skpr/package/pkg/utils/buildkit"
 )
 
 // DockerClient provides a mock docker client.
 type DockerClient struct {
-	BuildWg  sync.WaitGroup
-	PushWg   sync.WaitGroup
-	buildNum int
-	pushNum  int
+	BuildWg   sync.WaitGroup
+	PushWg    sync.WaitGroup
+	mu        sync.Mutex
+	builds    []docker.BuildImageOptions
+	buildkit  []buildkit.BuildOptions
+	tags      []string
+	buildNum  int
+	pushNum   int
+	pulls     []string
+	pullAuths []docker.AuthConfiguration
+	// PullError is returned when pulling any image.
+	PullError error
+	// BuildErrors are returned when building images with a matching name eg. "registry:tag".
+	BuildErrors map[string]error
+	// TagError is returned when tagging any image.
+	TagError error
+	// PushErrors are returned by successive pushes, before pushes succeed. A nil error is a successful push.
+	PushErrors []error
+	pushAuths  []docker.AuthConfiguration
+	// Delay each build and push to allow concurrency to be observed.
+	Delay    time.Duration
+	building activity
+	pushing  activity
+}
+
+// activity tracks the number of operations running at once.
+type activity struct {
+	active int
+	max    int
 }
 
 // BuildImage implements the interface.
 func (c *DockerClient) BuildImage(options docker.BuildImageOptions) error {
-	c.BuildWg.Done()
+	defer c.BuildWg.Done()
+	c.mu.Lock()
+	c.builds = append(c.builds, options)
 	c.buildNum++
-	return nil
+	err := c.BuildErrors[options.Name]
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return c.wait(options.Context, &c.building)
+}
+
+// Build implements the BuildKit interface.
+func (c *DockerClient) Build(options buildkit.BuildOptions) error {
+	c.mu.Lock()
+	c.buildkit = append(c.buildkit, options)
+	c.mu.Unlock()
+	return c.BuildImage(options.BuildImageOptions)
 }
 
 // PushImage implements the interface.
 func (c *DockerClient) PushImage(options docker.PushImageOptions, auth docker.AuthConfiguration) error {
-	c.PushWg.Done()
+	defer c.PushWg.Done()
+	c.mu.Lock()
 	c.pushNum++
+	c.pushAuths = append(c.pushAuths, auth)
+	if len(c.PushErrors) > 0 {
+		err := c.PushErrors[0]
+		c.PushErrors = c.PushErrors[1:]
+		if err != nil {
+			c.mu.Unlock()
+			return err
+		}
+	}
+	c.mu.Unlock()
+	if err := c.wait(options.Context, &c.pushing); err != nil {
+		return err
+	}
+	if options.OutputStream != nil && options.RawJSONStream {
+		digest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(options.Name+":"+options.Tag)))
+		fmt.Fprintf(options.OutputStream, "{\"status\":\"%s: digest: %s size: 1024\"}\n", options.Tag, digest)
+		fmt.Fprintf(options.OutputStream, "{\"progressDetail\":{},\"aux\":{\"Tag\":\"%s\",\"Digest\":\"%s\",\"Size\":1024}}\n", options.Tag, digest)
+	}
 	return nil
 }
 
+// PullImage implements the interface.
+func (c *DockerClient) PullImage(options docker.PullImageOptions, auth docker.AuthConfiguration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pulls = append(c.pulls, fmt.Sprintf("%s:%s", options.Repository, options.Tag))
+	c.pullAuths = append(c.pullAuths, auth)
+	return c.PullError
+}
+
+// InspectImage implements the interface.
+func (c *DockerClient) InspectImage(name string) (*docker.Image, error) {
+	repository := name
+	if i := strings.LastIndex(name, ":"); i > 0 {
+		repository = name[:i]
+	}
+
+	return &docker.Image{
+		ID:          fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(name))),
+		Size:        int64(len(name)),
+		RepoDigests: []string{fmt.Sprintf("%s@sha256:%x", repository, sha256.Sum256([]byte(name)))},
+		RootFS: &docker.RootFS{
+			Type:   "layers",
+			Layers: []string{"sha256:base", fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(name)))},
+		},
+	}, nil
+}
+
+// TagImage implements the interface.
+func (c *DockerClient) TagImage(name string, options docker.TagImageOptions) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.TagError != nil {
+		return c.TagError
+	}
+	c.tags = append(c.tags, fmt.Sprintf("%s:%s", options.Repo, options.Tag))
+	return nil
+}
+
+// Tags returns the tags which were applied to images.
+func (c *DockerClient) Tags() []string {
+	c.BuildWg.Wait()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tags
+}
+
+// Helper function to simulate a long running operation, which can be cancelled.
+func (c *DockerClient) wait(ctx context.Context, a *activity) error {
+	c.mu.Lock()
+	a.active++
+	if a.active > a.max {
+		a.max = a.active
+	}
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		a.active--
+		c.mu.Unlock()
+	}()
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	select {
+	case <-time.After(c.Delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// MaxActiveBuilds returns the highest number of builds which ran at once.
+func (c *DockerClient) MaxActiveBuilds() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.building.max
+}
+
+// MaxActivePushes returns the highest number of pushes which ran at once.
+func (c *DockerClient) MaxActivePushes() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pushing.max
+}
+
 // BuildCount returns the build count.
 func (c *DockerClient) BuildCount() int {
 	c.BuildWg.Wait()
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.buildNum
 }
 
 // PushCount returns the push count.
 func (c *DockerClient) PushCount() int {
 	c.PushWg.Wait()
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.pushNum
 }
+
+// PushAuths returns the credentials used by each push, in the order they were started.
+func (c *DockerClient) PushAuths() []docker.AuthConfiguration {
+	c.PushWg.Wait()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pushAuths
+}
+
+// Builds returns the options for each build, in the order they were started.
+func (c *DockerClient) Builds() []docker.BuildImageOptions {
+	c.BuildWg.Wait()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.builds
+}
+
+// BuildKitBuilds returns the options for each BuildKit build, in the order they were started.
+func (c *DockerClient) BuildKitBuilds() []buildkit.BuildOptions {
+	c.BuildWg.Wait()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.buildkit
+}
+
+// Pulls returns the images which were pulled.
+func (c *DockerClient) Pulls() []string {
+	c.BuildWg.Wait()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pulls
+}
+
+// PullAuths returns the credentials used by each pull, in the order they were started.
+func (c *DockerClient) PullAuths() []docker.AuthConfiguration {
+	c.BuildWg.Wait()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pullAuths
+}
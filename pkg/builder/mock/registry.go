@@ -0,0 +1,41 @@
+package mock
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+
+	docker "github.com/fsouza/go-dockerclient"
+
+	"github.com/skpr/package/pkg/utils/registry"
+)
+
+// RegistryClient provides a mock registry client.
+type RegistryClient struct {
+	mu      sync.Mutex
+	indexes map[string][]registry.IndexManifest
+}
+
+// PushIndex implements the interface.
+func (c *RegistryClient) PushIndex(ctx context.Context, repository, tag string, manifests []registry.IndexManifest, auth docker.AuthConfiguration) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.indexes == nil {
+		c.indexes = make(map[string][]registry.IndexManifest)
+	}
+
+	name := fmt.Sprintf("%s:%s", repository, tag)
+
+	c.indexes[name] = manifests
+
+	return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(name))), nil
+}
+
+// Indexes returns the manifests referenced by each index which was pushed, keyed by repository:tag.
+func (c *RegistryClient) Indexes() map[string][]registry.IndexManifest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.indexes
+}
@@ -0,0 +1,176 @@
+package builder
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/skpr/package/pkg/utils/image"
+	"github.com/skpr/package/pkg/utils/manifest"
+)
+
+// names of an image once resolved using the naming templates.
+type names struct {
+	// repository the image is pushed to.
+	repository string
+	// tags applied to the image. The first tag is the primary tag.
+	tags []string
+	// cache tag which layers are reused from. Empty when the cache is disabled.
+	cache string
+}
+
+// Reference to the image using the primary tag eg. repository:tag.
+func (n names) reference() string {
+	return fmt.Sprintf("%s:%s", n.repository, n.tags[0])
+}
+
+// Reference to the cache eg. repository:cache.
+func (n names) cacheReference() string {
+	return fmt.Sprintf("%s:%s", n.repository, n.cache)
+}
+
+// Names of the image built for a platform, each tag is suffixed with the platform eg. 1.0.0-linux-arm64.
+func (n names) platform(platform string) names {
+	tags := make([]string, len(n.tags))
+
+	for i, tag := range n.tags {
+		tags[i] = image.PlatformTag(tag, platform)
+	}
+
+	platformNames := names{
+		repository: n.repository,
+		tags:       tags,
+	}
+
+	if n.cache != "" {
+		platformNames.cache = image.PlatformTag(n.cache, platform)
+	}
+
+	return platformNames
+}
+
+// Helper function to resolve the names of every image in a package.
+// Values provided by the params take precedence over those declared in the manifest.
+//
+// Additional tags eg. "latest" are evaluated using the tag template in place of the version,
+// so they remain unique when images share a repository eg. "latest-<image>" with the default preset.
+// Images which would overwrite each other by resolving to the same reference are rejected.
+func resolveNames(pkg manifest.Manifest, params Params) (map[string]names, error) {
+	naming, err := image.NewNaming(
+		firstNonEmpty(params.NamingPreset, pkg.Naming.Preset),
+		firstNonEmpty(params.RepositoryTemplate, pkg.Naming.Repository),
+		firstNonEmpty(params.TagTemplate, pkg.Naming.Tag),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := make(map[string]names)
+
+	// Image which owns each reference eg. repository:tag.
+	owners := make(map[string]string)
+
+	claim := func(name, reference string) error {
+		owner, ok := owners[reference]
+		if !ok {
+			owners[reference] = name
+			return nil
+		}
+
+		if owner == name {
+			return fmt.Errorf("image %q uses %s as both a tag and its cache", name, reference)
+		}
+
+		return fmt.Errorf("images %q and %q both resolve to %s, the tag template must distinguish images which share a repository", owner, name, reference)
+	}
+
+	for _, name := range pkg.Names() {
+		data := image.Data{
+			Registry: params.Registry,
+			Image:    name,
+			Version:  params.Version,
+			Git:      params.Git,
+		}
+
+		repository, err := naming.Repository(data)
+		if err != nil {
+			return nil, fmt.Errorf("image %q: %w", name, err)
+		}
+
+		n := names{
+			repository: repository,
+		}
+
+		seen := make(map[string]bool)
+
+		// Additional tags are the same template evaluated with a different version.
+		for _, version := range append(append([]string{params.Version}, params.Tags...), pkg.Images[name].Tags...) {
+			data.Version = version
+
+			tag, err := naming.Tag(data)
+			if err != nil {
+				return nil, fmt.Errorf("image %q: %w", name, err)
+			}
+
+			if seen[tag] {
+				continue
+			}
+
+			seen[tag] = true
+			n.tags = append(n.tags, tag)
+
+			if err := claim(name, fmt.Sprintf("%s:%s", repository, tag)); err != nil {
+				return nil, err
+			}
+		}
+
+		// Images which are not pushed eg. the compile image are never cached, because they
+		// may contain source code and secrets.
+		if params.CacheVersion != "" && shouldPush(name, pkg.Images[name]) {
+			data.Version = params.CacheVersion
+
+			n.cache, err = naming.Tag(data)
+			if err != nil {
+				return nil, fmt.Errorf("image %q has an invalid cache tag: %w", name, err)
+			}
+
+			if err := claim(name, n.cacheReference()); err != nil {
+				return nil, err
+			}
+		}
+
+		resolved[name] = n
+	}
+
+	return resolved, nil
+}
+
+// Helper function to return the repositories which images are pushed to.
+func pushRepositories(pkg manifest.Manifest, resolved map[string]names) []string {
+	var repositories []string
+
+	seen := make(map[string]bool)
+
+	for _, name := range pkg.Names() {
+		if !shouldPush(name, pkg.Images[name]) || seen[resolved[name].repository] {
+			continue
+		}
+
+		seen[resolved[name].repository] = true
+		repositories = append(repositories, resolved[name].repository)
+	}
+
+	sort.Strings(repositories)
+
+	return repositories
+}
+
+// Helper function to return the first value which is not empty.
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
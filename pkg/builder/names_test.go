@@ -0,0 +1,42 @@
+package builder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skpr/package/pkg/utils/manifest"
+)
+
+func TestResolveNamesDuplicate(t *testing.T) {
+	pkg := manifest.Manifest{
+		Images: map[string]manifest.Image{
+			"compile": {},
+			"web":     {},
+		},
+	}
+
+	params := Params{
+		Registry: "foo",
+		Version:  "222",
+	}
+
+	resolved, err := resolveNames(pkg, params)
+	assert.NoError(t, err)
+	assert.Equal(t, "foo:222-web", resolved["web"].reference())
+
+	// Images which share a repository must be distinguished by the tag.
+	params.TagTemplate = "{{ .Version }}"
+
+	_, err = resolveNames(pkg, params)
+	assert.EqualError(t, err, `images "compile" and "web" both resolve to foo:222, the tag template must distinguish images which share a repository`)
+
+	// Including the cache.
+	params.TagTemplate = "{{ .Version }}-{{ .Image }}"
+	params.CacheVersion = "cache"
+	params.Tags = []string{"cache"}
+
+	_, err = resolveNames(pkg, params)
+	assert.EqualError(t, err, `image "web" uses foo:cache-web as both a tag and its cache`)
+
+}
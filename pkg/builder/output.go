@@ -0,0 +1,205 @@
+package builder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// OutputFormatJSON encodes the build output as JSON.
+	OutputFormatJSON = "json"
+	// OutputFormatYAML encodes the build output as YAML.
+	OutputFormatYAML = "yaml"
+)
+
+const (
+	// StatusBuilt is assigned to images which were built but not pushed.
+	StatusBuilt = "built"
+	// StatusPushed is assigned to images which were built and pushed.
+	StatusPushed = "pushed"
+	// StatusFailed is assigned to images which failed to build or push.
+	StatusFailed = "failed"
+	// StatusSkipped is assigned to images which were not built or pushed, because an image they depend on failed.
+	StatusSkipped = "skipped"
+	// StatusInterrupted is assigned to images which were being built or pushed when the build was cancelled.
+	StatusInterrupted = "interrupted"
+)
+
+// BuildOutput provided to tasks which trigger a build.
+type BuildOutput struct {
+	Images map[string]string `json:"image" yaml:"image"`
+	// Results for each image which was built.
+	Results map[string]ImageOutput `json:"results" yaml:"results"`
+}
+
+// ImageOutput describes the result of building and pushing a single image.
+type ImageOutput struct {
+	// Reference to the image eg. registry:tag.
+	Reference string `json:"reference" yaml:"reference"`
+	// Tags applied to the image, starting with the tag used by the reference.
+	Tags []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	// Digest of the pushed image eg. sha256:...
+	Digest string `json:"digest,omitempty" yaml:"digest,omitempty"`
+	// PinnedReference to the pushed image by digest eg. registry@sha256:...
+	PinnedReference string `json:"pinnedReference,omitempty" yaml:"pinnedReference,omitempty"`
+	// Platforms the image was built for, when built for multiple platforms.
+	Platforms []PlatformOutput `json:"platforms,omitempty" yaml:"platforms,omitempty"`
+	// Size of the image in bytes, the sum of each platform when built for multiple platforms.
+	Size int64 `json:"size,omitempty" yaml:"size,omitempty"`
+	// Layers in the image, the sum of each platform when built for multiple platforms.
+	Layers int `json:"layers,omitempty" yaml:"layers,omitempty"`
+	// Duration is the elapsed time from the start of the build until the image was pushed.
+	// Platforms and tags are built and pushed concurrently, so each duration is elapsed time rather than a sum.
+	Duration Duration `json:"duration,omitempty" yaml:"duration,omitempty"`
+	// CompileDuration is the time taken to build the compile image, which the image depends on.
+	CompileDuration Duration `json:"compileDuration,omitempty" yaml:"compileDuration,omitempty"`
+	// BuildDuration is the time taken to build the image, including pulling the cache.
+	BuildDuration Duration `json:"buildDuration" yaml:"buildDuration"`
+	// TagDuration is the time taken to apply the additional tags.
+	TagDuration Duration `json:"tagDuration,omitempty" yaml:"tagDuration,omitempty"`
+	// PushDuration is the time taken to push the image, including retries.
+	PushDuration Duration `json:"pushDuration,omitempty" yaml:"pushDuration,omitempty"`
+	// Status of the image eg. pushed.
+	Status string `json:"status" yaml:"status"`
+}
+
+// Duration of a phase, which is encoded as a string eg. "1m30s" in both JSON and YAML.
+type Duration time.Duration
+
+// String implements the fmt.Stringer interface.
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var value string
+
+	if err := json.Unmarshal(b, &value); err != nil {
+		return err
+	}
+
+	return d.parse(value)
+}
+
+// MarshalYAML implements the yaml.Marshaler interface.
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	var value string
+
+	if err := node.Decode(&value); err != nil {
+		return err
+	}
+
+	return d.parse(value)
+}
+
+// Helper function to parse a duration eg. "1m30s".
+func (d *Duration) parse(value string) error {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(duration)
+
+	return nil
+}
+
+// PlatformOutput describes an image built for a single platform.
+type PlatformOutput struct {
+	// Platform the image was built for eg. linux/arm64.
+	Platform string `json:"platform" yaml:"platform"`
+	// Reference to the image for the platform eg. registry:tag-linux-arm64.
+	Reference string `json:"reference" yaml:"reference"`
+	// Digest of the pushed image eg. sha256:...
+	Digest string `json:"digest,omitempty" yaml:"digest,omitempty"`
+}
+
+// Encode the build output in the given format.
+func (o BuildOutput) Encode(w io.Writer, format string) error {
+	return encode(w, format, o)
+}
+
+// Summary of each image as a human-readable table.
+func (o BuildOutput) Summary(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "IMAGE\tSTATUS\tDURATION\tSIZE\tLAYERS")
+
+	var names []string
+
+	for name := range o.Results {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		result := o.Results[name]
+
+		size, layers := "-", "-"
+
+		if result.Size > 0 {
+			size = formatSize(result.Size)
+		}
+
+		if result.Layers > 0 {
+			layers = strconv.Itoa(result.Layers)
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", name, result.Status, time.Duration(result.Duration).Round(time.Second), size, layers)
+	}
+
+	return tw.Flush()
+}
+
+// Helper function to format a size in bytes using decimal units eg. 1.5MB, the same as the Docker CLI.
+func formatSize(size int64) string {
+	const unit = 1000
+
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+
+	div, exp := int64(unit), 0
+
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f%cB", float64(size)/float64(div), "kMGTPE"[exp])
+}
+
+// Helper function to encode a value in the given format.
+func encode(w io.Writer, format string, v interface{}) error {
+	switch format {
+	case OutputFormatJSON:
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		return e.Encode(v)
+	case OutputFormatYAML:
+		e := yaml.NewEncoder(w)
+		defer e.Close()
+		return e.Encode(v)
+	}
+
+	return fmt.Errorf("unsupported output format: %s", format)
+}
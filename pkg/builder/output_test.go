@@ -0,0 +1,120 @@
+package builder
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestEncode(t *testing.T) {
+	output := BuildOutput{
+		Images: map[string]string{
+			"app": "foo:222-app",
+		},
+		Results: map[string]ImageOutput{
+			"app": {
+				Reference:     "foo:222-app",
+				Digest:        "sha256:abc",
+				Size:          1024,
+				Duration:      Duration(90 * time.Second),
+				BuildDuration: Duration(2 * time.Second),
+				PushDuration:  Duration(time.Second),
+				Status:        StatusPushed,
+			},
+		},
+	}
+
+	var b bytes.Buffer
+
+	assert.NoError(t, output.Encode(&b, OutputFormatJSON))
+	assert.JSONEq(t, `{
+  "image": {"app": "foo:222-app"},
+  "results": {
+    "app": {
+      "reference": "foo:222-app",
+      "digest": "sha256:abc",
+      "size": 1024,
+      "duration": "1m30s",
+      "buildDuration": "2s",
+      "pushDuration": "1s",
+      "status": "pushed"
+    }
+  }
+}`, b.String())
+
+	b.Reset()
+
+	assert.NoError(t, output.Encode(&b, OutputFormatYAML))
+	assert.Equal(t, `image:
+    app: foo:222-app
+results:
+    app:
+        reference: foo:222-app
+        digest: sha256:abc
+        size: 1024
+        duration: 1m30s
+        buildDuration: 2s
+        pushDuration: 1s
+        status: pushed
+`, b.String())
+
+	assert.Error(t, output.Encode(&b, "xml"))
+}
+
+func TestDuration(t *testing.T) {
+	var result ImageOutput
+
+	assert.NoError(t, json.Unmarshal([]byte(`{"duration": "1m30s", "buildDuration": "2s"}`), &result))
+	assert.Equal(t, Duration(90*time.Second), result.Duration)
+	assert.Equal(t, Duration(2*time.Second), result.BuildDuration)
+
+	result = ImageOutput{}
+
+	assert.NoError(t, yaml.Unmarshal([]byte("duration: 1m30s\nbuildDuration: 2s\n"), &result))
+	assert.Equal(t, Duration(90*time.Second), result.Duration)
+	assert.Equal(t, Duration(2*time.Second), result.BuildDuration)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"duration": 90}`), &result))
+	assert.Error(t, yaml.Unmarshal([]byte("duration: soon\n"), &result))
+}
+
+func TestSummary(t *testing.T) {
+	output := BuildOutput{
+		Results: map[string]ImageOutput{
+			"compile": {
+				Size:     1500000,
+				Layers:   12,
+				Duration: Duration(90 * time.Second),
+				Status:   StatusBuilt,
+			},
+			"app": {
+				Size:     2340000000,
+				Layers:   14,
+				Duration: Duration(150 * time.Second),
+				Status:   StatusPushed,
+			},
+			"web": {
+				Status: StatusSkipped,
+			},
+		},
+	}
+
+	var b bytes.Buffer
+
+	assert.NoError(t, output.Summary(&b))
+	assert.Equal(t, `IMAGE    STATUS   DURATION  SIZE   LAYERS
+app      pushed   2m30s     2.3GB  14
+compile  built    1m30s     1.5MB  12
+web      skipped  0s        -      -
+`, b.String())
+}
+
+func TestFormatSize(t *testing.T) {
+	assert.Equal(t, "512B", formatSize(512))
+	assert.Equal(t, "1.0kB", formatSize(1000))
+	assert.Equal(t, "15.2MB", formatSize(15200000))
+}
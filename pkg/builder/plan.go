@@ -0,0 +1,211 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/skpr/package/pkg/utils/manifest"
+)
+
+// Plan of a build, which is resolved without contacting the Docker daemon or registry.
+type Plan struct {
+	// Order the images are built in. Images are built concurrently once their dependencies are built.
+	Order []string `json:"order" yaml:"order"`
+	// Images in the package.
+	Images map[string]ImagePlan `json:"images" yaml:"images"`
+}
+
+// ImagePlan describes how a single image would be built and pushed.
+type ImagePlan struct {
+	// Dockerfile path, relative to the context directory.
+	Dockerfile string `json:"dockerfile" yaml:"dockerfile"`
+	// Context directory for the build.
+	Context string `json:"context" yaml:"context"`
+	// Target stage of a multi-stage Dockerfile.
+	Target string `json:"target,omitempty" yaml:"target,omitempty"`
+	// Depends on these images being built first.
+	Depends []string `json:"depends,omitempty" yaml:"depends,omitempty"`
+	// Reference to the image eg. registry:tag.
+	Reference string `json:"reference" yaml:"reference"`
+	// Tags applied to the image, starting with the tag used by the reference.
+	Tags []string `json:"tags" yaml:"tags"`
+	// Builds of the image, one for each platform.
+	Builds []BuildPlan `json:"builds" yaml:"builds"`
+	// Push references eg. registry:tag which would be pushed.
+	Push []string `json:"push,omitempty" yaml:"push,omitempty"`
+}
+
+// BuildPlan describes how an image would be built for a single platform.
+type BuildPlan struct {
+	// Platform the image is built for. Empty means the platform of the daemon.
+	Platform string `json:"platform,omitempty" yaml:"platform,omitempty"`
+	// Reference the image is built as eg. registry:tag.
+	Reference string `json:"reference" yaml:"reference"`
+	// BuildArgs passed to the build eg. KEY=VALUE. Values which look like secrets are masked.
+	BuildArgs []string `json:"buildArgs,omitempty" yaml:"buildArgs,omitempty"`
+}
+
+// DryRun resolves the plan for a package without building or pushing any images.
+// The registry is only contacted when validating authentication.
+func DryRun(ctx context.Context, params Params, validateAuth bool) (Plan, error) {
+	params = publish(ctx, params)
+
+	pkg, err := loadPackage(params)
+	if err != nil {
+		return Plan{}, err
+	}
+
+	plan, err := NewPlan(pkg, params)
+	if err != nil {
+		return plan, err
+	}
+
+	if validateAuth && !params.NoPush {
+		if _, err := resolveAuth(ctx, params); err != nil {
+			return plan, err
+		}
+
+		fmt.Fprintf(params.Writer, "Resolved registry authentication for %s\n", params.Registry)
+	}
+
+	return plan, nil
+}
+
+// NewPlan of how a package would be built.
+func NewPlan(pkg manifest.Manifest, params Params) (Plan, error) {
+	plan := Plan{
+		Images: make(map[string]ImagePlan),
+	}
+
+	p, err := prepare(pkg, params)
+	if err != nil {
+		return plan, err
+	}
+
+	plan.Order = p.graph.order
+
+	for _, imageName := range p.graph.order {
+		resolved := p.names[imageName]
+
+		img := ImagePlan{
+			Dockerfile: pkg.Images[imageName].Dockerfile,
+			Context:    pkg.Images[imageName].Context,
+			Target:     pkg.Images[imageName].Target,
+			Depends:    p.graph.dependencies[imageName],
+			Reference:  resolved.reference(),
+			Tags:       resolved.tags,
+		}
+
+		if img.Context == "" {
+			img.Context = params.Context
+		}
+
+		for _, platform := range p.platforms {
+			build := p.buildOptions(imageName, platform, pkg, params, time.Time{})
+
+			var args []string
+
+			for _, arg := range build.BuildArgs {
+				args = append(args, maskBuildArg(arg))
+			}
+
+			img.Builds = append(img.Builds, BuildPlan{
+				Platform:  platform,
+				Reference: build.Name,
+				BuildArgs: args,
+			})
+		}
+
+		if !params.NoPush {
+			img.Push = p.pushReferences(imageName, pkg.Images[imageName], params)
+		}
+
+		plan.Images[imageName] = img
+	}
+
+	return plan, nil
+}
+
+// Helper function to list the references which are pushed for an image, in the order they are pushed.
+func (p prepared) pushReferences(imageName string, img manifest.Image, params Params) []string {
+	var references []string
+
+	resolved := p.names[imageName]
+
+	if shouldPush(imageName, img) {
+		if p.multiPlatform {
+			for _, platform := range p.platforms {
+				references = append(references, p.platformNames(imageName, platform).reference())
+			}
+		}
+
+		// Images built for multiple platforms are pushed as an index under each tag.
+		for _, tag := range resolved.tags {
+			references = append(references, fmt.Sprintf("%s:%s", resolved.repository, tag))
+		}
+	}
+
+	// The cache is pushed for every image which is pushed.
+	if resolved.cache != "" {
+		for _, platform := range p.platforms {
+			references = append(references, p.platformNames(imageName, platform).cacheReference())
+		}
+	}
+
+	return references
+}
+
+// Encode the plan in the given format.
+func (p Plan) Encode(w io.Writer, format string) error {
+	return encode(w, format, p)
+}
+
+// Print the plan in a human-readable format.
+func (p Plan) Print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Build order:\t%s\n", strings.Join(p.Order, ", "))
+
+	for _, name := range p.Order {
+		img := p.Images[name]
+
+		fmt.Fprintf(tw, "\n%s\n", name)
+		fmt.Fprintf(tw, "  Dockerfile:\t%s\n", img.Dockerfile)
+		fmt.Fprintf(tw, "  Context:\t%s\n", img.Context)
+
+		if img.Target != "" {
+			fmt.Fprintf(tw, "  Target:\t%s\n", img.Target)
+		}
+
+		if len(img.Depends) > 0 {
+			fmt.Fprintf(tw, "  Depends:\t%s\n", strings.Join(img.Depends, ", "))
+		}
+
+		fmt.Fprintf(tw, "  Image:\t%s\n", img.Reference)
+		fmt.Fprintf(tw, "  Tags:\t%s\n", strings.Join(img.Tags, ", "))
+
+		for _, build := range img.Builds {
+			if build.Platform != "" {
+				fmt.Fprintf(tw, "  Build:\t%s (%s)\n", build.Reference, build.Platform)
+			}
+
+			for _, arg := range build.BuildArgs {
+				fmt.Fprintf(tw, "  Build arg:\t%s\n", arg)
+			}
+		}
+
+		if len(img.Push) == 0 {
+			fmt.Fprintf(tw, "  Push:\t-\n")
+		}
+
+		for _, reference := range img.Push {
+			fmt.Fprintf(tw, "  Push:\t%s\n", reference)
+		}
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,119 @@
+package builder
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skpr/package/pkg/utils/manifest"
+)
+
+func TestNewPlan(t *testing.T) {
+	pkg := manifest.Manifest{
+		Images: map[string]manifest.Image{
+			"compile": {Dockerfile: ".skpr/package/compile/Dockerfile", BuildArgs: map[string]string{"COMPOSER_TOKEN": "abc123"}},
+			"web":     {Dockerfile: ".skpr/package/web/Dockerfile", Target: "prod"},
+		},
+	}
+
+	params := Params{
+		Registry: "foo",
+		Version:  "222",
+		Context:  "bar",
+		Tags:     []string{"latest"},
+	}
+
+	plan, err := NewPlan(pkg, params)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"compile", "web"}, plan.Order)
+
+	assert.Equal(t, ImagePlan{
+		Dockerfile: ".skpr/package/compile/Dockerfile",
+		Context:    "bar",
+		Reference:  "foo:222-compile",
+		Tags:       []string{"222-compile", "latest-compile"},
+		Builds: []BuildPlan{
+			{
+				Reference: "foo:222-compile",
+				BuildArgs: []string{"COMPOSER_TOKEN=********", "SKPR_VERSION=222"},
+			},
+		},
+	}, plan.Images["compile"])
+
+	assert.Equal(t, ImagePlan{
+		Dockerfile: ".skpr/package/web/Dockerfile",
+		Context:    "bar",
+		Target:     "prod",
+		Depends:    []string{"compile"},
+		Reference:  "foo:222-web",
+		Tags:       []string{"222-web", "latest-web"},
+		Builds: []BuildPlan{
+			{
+				Reference: "foo:222-web",
+				BuildArgs: []string{"SKPR_VERSION=222", "COMPILE_IMAGE=foo:222-compile"},
+			},
+		},
+		Push: []string{"foo:222-web", "foo:latest-web"},
+	}, plan.Images["web"])
+
+	var b bytes.Buffer
+
+	assert.NoError(t, plan.Print(&b))
+	assert.Contains(t, b.String(), "Build order:  compile, web\n")
+	assert.Contains(t, b.String(), "  Build arg:   COMPILE_IMAGE=foo:222-compile\n")
+	assert.Contains(t, b.String(), "  Push:        foo:latest-web\n")
+	assert.NotContains(t, b.String(), "abc123")
+
+	b.Reset()
+
+	assert.NoError(t, plan.Encode(&b, OutputFormatJSON))
+	assert.Contains(t, b.String(), `"order": [`)
+}
+
+func TestNewPlanPlatforms(t *testing.T) {
+	pkg := manifest.Manifest{
+		Images: map[string]manifest.Image{
+			"compile": {Dockerfile: ".skpr/package/compile/Dockerfile"},
+			"web":     {Dockerfile: ".skpr/package/web/Dockerfile"},
+		},
+	}
+
+	params := Params{
+		Registry:     "foo",
+		Version:      "222",
+		Platforms:    []string{"linux/amd64", "linux/arm64"},
+		CacheVersion: "cache",
+	}
+
+	plan, err := NewPlan(pkg, params)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []BuildPlan{
+		{
+			Platform:  "linux/amd64",
+			Reference: "foo:222-web-linux-amd64",
+			BuildArgs: []string{"SKPR_VERSION=222", "COMPILE_IMAGE=foo:222-compile-linux-amd64"},
+		},
+		{
+			Platform:  "linux/arm64",
+			Reference: "foo:222-web-linux-arm64",
+			BuildArgs: []string{"SKPR_VERSION=222", "COMPILE_IMAGE=foo:222-compile-linux-arm64"},
+		},
+	}, plan.Images["web"].Builds)
+
+	assert.Equal(t, []string{
+		"foo:222-web-linux-amd64",
+		"foo:222-web-linux-arm64",
+		"foo:222-web",
+		"foo:cache-web-linux-amd64",
+		"foo:cache-web-linux-arm64",
+	}, plan.Images["web"].Push)
+
+	// The compile image is not cached, because it is not pushed.
+	assert.Empty(t, plan.Images["compile"].Push)
+
+	_, err = NewPlan(manifest.Manifest{}, params)
+	assert.EqualError(t, err, `"compile" is a required dockerfile`)
+}
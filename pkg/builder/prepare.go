@@ -0,0 +1,120 @@
+package builder
+
+import (
+	"fmt"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+
+	"github.com/skpr/package/pkg/utils/image"
+	"github.com/skpr/package/pkg/utils/manifest"
+	"github.com/skpr/package/pkg/utils/registry"
+)
+
+// prepared package which has been validated, ready to be built.
+type prepared struct {
+	graph graph
+	// names of each image.
+	names map[string]names
+	// platforms each image is built for. An empty platform builds for the platform of the daemon.
+	platforms []string
+	// multiPlatform images are tagged per platform, then pushed as an index.
+	multiPlatform bool
+}
+
+// Helper function to validate a package and resolve how each image is built.
+func prepare(pkg manifest.Manifest, params Params) (prepared, error) {
+	var p prepared
+
+	if _, ok := pkg.Images[ImageNameCompile]; !ok {
+		return p, fmt.Errorf("%q is a required dockerfile", ImageNameCompile)
+	}
+
+	var err error
+
+	p.graph, err = newGraph(pkg)
+	if err != nil {
+		return p, err
+	}
+
+	if err := validateBuildKit(pkg, params); err != nil {
+		return p, err
+	}
+
+	if err := validateBuildArgs(pkg, params); err != nil {
+		return p, err
+	}
+
+	p.names, err = resolveNames(pkg, params)
+	if err != nil {
+		return p, err
+	}
+
+	p.platforms = params.Platforms
+	if len(p.platforms) == 0 {
+		p.platforms = []string{""}
+	}
+
+	p.multiPlatform = len(p.platforms) > 1
+
+	for _, platform := range params.Platforms {
+		if _, err := registry.ParsePlatform(platform); err != nil {
+			return p, err
+		}
+
+		if !p.multiPlatform {
+			continue
+		}
+
+		for _, imageName := range p.graph.order {
+			if tag := p.names[imageName].platform(platform).tags[0]; !image.ValidTag(tag) {
+				return p, fmt.Errorf("image %q: invalid tag: %s", imageName, tag)
+			}
+		}
+	}
+
+	return p, nil
+}
+
+// Names of an image built for a platform.
+func (p prepared) platformNames(imageName, platform string) names {
+	if p.multiPlatform {
+		return p.names[imageName].platform(platform)
+	}
+
+	return p.names[imageName]
+}
+
+// Helper function to assemble the build options for an image built for a platform.
+func (p prepared) buildOptions(imageName, platform string, pkg manifest.Manifest, params Params, created time.Time) docker.BuildImageOptions {
+	args := []docker.BuildArg{
+		{
+			Name:  BuildArgVersion,
+			Value: params.Version,
+		},
+	}
+
+	// Adds dependency image identifiers as args eg. COMPILE_IMAGE.
+	// That allows images to copy over files from the images they depend on,
+	// which were built for the same platform.
+	for _, dep := range p.graph.dependencies[imageName] {
+		args = append(args, docker.BuildArg{
+			Name:  BuildArgImage(dep),
+			Value: p.platformNames(dep, platform).reference(),
+		})
+	}
+
+	if params.InlineCache {
+		args = append(args, docker.BuildArg{
+			Name:  BuildArgInlineCache,
+			Value: "1",
+		})
+	}
+
+	labels := imageLabels(pkg.Labels, pkg.Images[imageName], params, created)
+
+	build := buildOptions(imageName, p.platformNames(imageName, platform).reference(), pkg.Images[imageName], params, args, labels)
+	build.Platform = platform
+
+	return build
+}
@@ -0,0 +1,44 @@
+package builder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// Helper function to push an image, returning the digest reported by the registry.
+// The raw JSON message stream is decoded into events, so the digest can be captured from the
+// auxiliary message which the daemon sends once the manifest has been pushed.
+func (b *Builder) push(options docker.PushImageOptions, auth docker.AuthConfiguration, w io.Writer) (string, error) {
+	var digest string
+
+	stream := decoder(w, PhasePush)
+	stream.Aux = func(msg json.RawMessage) {
+		var aux struct {
+			Digest string `json:"Digest"`
+		}
+
+		if json.Unmarshal(msg, &aux) == nil && aux.Digest != "" {
+			digest = aux.Digest
+		}
+	}
+
+	options.OutputStream = stream
+	options.RawJSONStream = true
+
+	err := b.dockerClient.PushImage(options, auth)
+	if cerr := stream.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err := stream.Err(); err != nil {
+		return "", fmt.Errorf("failed to push image: %w", err)
+	}
+
+	return digest, nil
+}
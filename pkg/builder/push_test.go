@@ -0,0 +1,53 @@
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skpr/package/pkg/builder/mock"
+)
+
+// streamClient writes a fixed JSON message stream for each push.
+type streamClient struct {
+	mock.DockerClient
+	stream string
+}
+
+func (c *streamClient) PushImage(options docker.PushImageOptions, auth docker.AuthConfiguration) error {
+	_, err := fmt.Fprint(options.OutputStream, c.stream)
+	return err
+}
+
+func TestPush(t *testing.T) {
+	client := &streamClient{
+		stream: `{"status":"The push refers to repository [foo]"}
+{"status":"Pushed","progressDetail":{},"id":"abc123"}
+{"status":"222-app: digest: sha256:def456 size: 1234"}
+{"progressDetail":{},"aux":{"Tag":"222-app","Digest":"sha256:def456","Size":1234}}
+`,
+	}
+
+	var b bytes.Buffer
+
+	digest, err := NewBuilder(client).push(docker.PushImageOptions{Name: "foo", Tag: "222-app"}, docker.AuthConfiguration{}, &b)
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256:def456", digest)
+	assert.Contains(t, b.String(), "222-app: digest: sha256:def456 size: 1234")
+}
+
+func TestPushStreamError(t *testing.T) {
+	client := &streamClient{
+		stream: `{"status":"The push refers to repository [foo]"}
+{"errorDetail":{"message":"denied: requested access to the resource is denied"},"error":"denied: requested access to the resource is denied"}
+`,
+	}
+
+	var b bytes.Buffer
+
+	_, err := NewBuilder(client).push(docker.PushImageOptions{Name: "foo", Tag: "222-app"}, docker.AuthConfiguration{}, &b)
+	assert.EqualError(t, err, "failed to push image: denied: requested access to the resource is denied")
+}
@@ -0,0 +1,220 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/docker/docker/pkg/jsonmessage"
+	docker "github.com/fsouza/go-dockerclient"
+
+	"github.com/skpr/package/pkg/utils/registry"
+)
+
+const (
+	// DefaultPushAttempts used when the number of push attempts has not been set.
+	DefaultPushAttempts = 3
+	// DefaultPushRetryDelay used when the total delay between push attempts has not been set.
+	DefaultPushRetryDelay = time.Minute
+)
+
+const (
+	// Delay before the first retry, which doubles for each subsequent retry.
+	retryInitialDelay = time.Second
+	// Maximum delay between two attempts, unless the registry asks for longer.
+	retryMaxDelay = 30 * time.Second
+)
+
+var (
+	// Errors which the daemon relays from the registry as messages, rather than status codes.
+	transientRegex = regexp.MustCompile(`(?i)(connection reset|broken pipe|unexpected EOF|i/o timeout|TLS handshake timeout|toomanyrequests|too many requests|\b5\d\d (internal server error|bad gateway|service unavailable|gateway timeout)\b)`)
+	// ECR tokens are valid for 12 hours, which long builds can outlive.
+	expiredRegex = regexp.MustCompile(`(?i)authorization token has expired`)
+	// Retry-After is only available as part of the message when relayed by the daemon.
+	retryAfterRegex = regexp.MustCompile(`(?i)retry[- ]after:?\s*(\d+)`)
+)
+
+// Helper function to apply the default number of push attempts.
+func pushAttempts(attempts int) int {
+	if attempts < 1 {
+		return DefaultPushAttempts
+	}
+
+	return attempts
+}
+
+// Helper function to apply the default total delay between push attempts.
+func pushRetryDelay(delay time.Duration) time.Duration {
+	if delay <= 0 {
+		return DefaultPushRetryDelay
+	}
+
+	return delay
+}
+
+// credentials shared by concurrent pushes, which are renewed once when they expire.
+type credentials struct {
+	mu   sync.Mutex
+	auth docker.AuthConfiguration
+	// renew the credentials eg. by requesting a new ECR token. Nil if they cannot be renewed.
+	renew func(ctx context.Context) (docker.AuthConfiguration, error)
+}
+
+// Helper function to return the current credentials.
+func (c *credentials) get() docker.AuthConfiguration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.auth
+}
+
+// Helper function to renew credentials which have expired. Pushes which failed with the
+// same expired credentials share the credentials renewed by the first of them.
+func (c *credentials) refresh(ctx context.Context, expired docker.AuthConfiguration) (docker.AuthConfiguration, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.auth != expired {
+		return c.auth, nil
+	}
+
+	if c.renew == nil {
+		return c.auth, errors.New("registry credentials cannot be renewed")
+	}
+
+	auth, err := c.renew(ctx)
+	if err != nil {
+		return c.auth, err
+	}
+
+	c.auth = auth
+
+	return c.auth, nil
+}
+
+// retryable describes how a failed push can be retried.
+type retryable struct {
+	// after is the minimum delay requested by the registry.
+	after time.Duration
+	// reauthenticate before retrying, because the credentials have expired.
+	reauthenticate bool
+}
+
+// Helper function to determine whether a push failed with a transient error.
+func classify(err error) (retryable, bool) {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return retryable{}, false
+	}
+
+	if expiredRegex.MatchString(err.Error()) {
+		return retryable{reauthenticate: true}, true
+	}
+
+	var after time.Duration
+
+	if match := retryAfterRegex.FindStringSubmatch(err.Error()); match != nil {
+		seconds, _ := strconv.Atoi(match[1])
+		after = time.Duration(seconds) * time.Second
+	}
+
+	var status *registry.StatusError
+	if errors.As(err, &status) {
+		return retryable{after: status.RetryAfter}, transientStatus(status.StatusCode)
+	}
+
+	var dockerErr *docker.Error
+	if errors.As(err, &dockerErr) && transientStatus(dockerErr.Status) {
+		return retryable{after: after}, true
+	}
+
+	var jsonErr *jsonmessage.JSONError
+	if errors.As(err, &jsonErr) && transientStatus(jsonErr.Code) {
+		return retryable{after: after}, true
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return retryable{after: after}, true
+	}
+
+	return retryable{after: after}, transientRegex.MatchString(err.Error())
+}
+
+// Helper function to determine whether a status code is worth retrying.
+func transientStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// Helper function to calculate the delay before a retry using exponential backoff with jitter,
+// so concurrent pushes which failed together do not retry together.
+func backoff(initial time.Duration, retry int) time.Duration {
+	delay := initial << (retry - 1)
+	if delay <= 0 || delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+
+	// Between half and the full delay.
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// Helper function to run a push, retrying transient errors with exponential backoff.
+// Retries stop once the attempts are exhausted or the total delay would be exceeded.
+func (b *Builder) retry(ctx context.Context, params Params, creds *credentials, w io.Writer, push func(auth docker.AuthConfiguration) error) error {
+	attempts := pushAttempts(params.PushAttempts)
+	limit := pushRetryDelay(params.PushRetryDelay)
+
+	initial := b.retryDelay
+	if initial <= 0 {
+		initial = retryInitialDelay
+	}
+
+	var waited time.Duration
+
+	for attempt := 1; ; attempt++ {
+		auth := creds.get()
+
+		err := push(auth)
+		if err == nil {
+			return nil
+		}
+
+		retry, ok := classify(err)
+		if !ok || ctx.Err() != nil || attempt >= attempts {
+			return err
+		}
+
+		delay := backoff(initial, attempt)
+		if retry.after > delay {
+			delay = retry.after
+		}
+
+		if waited+delay > limit {
+			fmt.Fprintf(w, "Not retrying push, because the total delay would exceed %s\n", limit)
+			return err
+		}
+
+		fmt.Fprintf(w, "Push failed (attempt %d of %d), retrying in %s: %s\n", attempt, attempts, delay.Round(time.Millisecond), err)
+
+		if retry.reauthenticate {
+			fmt.Fprintln(w, "Registry credentials have expired, reauthenticating")
+
+			if _, rerr := creds.refresh(ctx, auth); rerr != nil {
+				return fmt.Errorf("failed to reauthenticate: %w", rerr)
+			}
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+
+		waited += delay
+	}
+}
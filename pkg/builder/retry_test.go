@@ -0,0 +1,53 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/pkg/jsonmessage"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skpr/package/pkg/utils/registry"
+)
+
+func TestClassify(t *testing.T) {
+	for _, tc := range []struct {
+		err      error
+		expected retryable
+		ok       bool
+	}{
+		{err: fmt.Errorf("failed to push image: %w", syscall.ECONNRESET), ok: true},
+		{err: &docker.Error{Status: http.StatusBadGateway}, ok: true},
+		{err: &docker.Error{Status: http.StatusUnauthorized}, ok: false},
+		{err: &jsonmessage.JSONError{Message: "toomanyrequests: retry after 20 seconds"}, expected: retryable{after: 20 * time.Second}, ok: true},
+		{err: &jsonmessage.JSONError{Message: "received unexpected HTTP status: 503 Service Unavailable"}, ok: true},
+		{err: &jsonmessage.JSONError{Message: "denied: Your authorization token has expired. Reauthenticate and try again."}, expected: retryable{reauthenticate: true}, ok: true},
+		{err: &jsonmessage.JSONError{Message: "denied: requested access to the resource is denied"}, ok: false},
+		{err: &registry.StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Minute}, expected: retryable{after: time.Minute}, ok: true},
+		{err: &registry.StatusError{StatusCode: http.StatusNotFound}, ok: false},
+		{err: fmt.Errorf("push: %w", errors.New("context deadline exceeded: 503 service unavailable")), ok: true},
+	} {
+		retry, ok := classify(tc.err)
+		assert.Equal(t, tc.ok, ok, tc.err.Error())
+		assert.Equal(t, tc.expected, retry, tc.err.Error())
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for retry := 1; retry <= 10; retry++ {
+		delay := backoff(time.Second, retry)
+
+		expected := time.Second << (retry - 1)
+		if expected > retryMaxDelay {
+			expected = retryMaxDelay
+		}
+
+		assert.GreaterOrEqual(t, delay, expected/2)
+		assert.LessOrEqual(t, delay, expected)
+	}
+}
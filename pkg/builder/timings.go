@@ -0,0 +1,98 @@
+package builder
+
+import (
+	"sync"
+	"time"
+)
+
+// phaseTag is the phase where the additional tags are applied to an image.
+const phaseTag = "tag"
+
+// span of wall-clock time, from the earliest start to the latest end of work which may run concurrently.
+type span struct {
+	start time.Time
+	end   time.Time
+}
+
+// Helper function to extend the span to include work which ran from start until end.
+func (s *span) add(start, end time.Time) {
+	if s.start.IsZero() || start.Before(s.start) {
+		s.start = start
+	}
+
+	if end.After(s.end) {
+		s.end = end
+	}
+}
+
+// Helper function to return the time elapsed from the start to the end of the span.
+func (s *span) elapsed() time.Duration {
+	if s == nil || s.start.IsZero() {
+		return 0
+	}
+
+	return s.end.Sub(s.start)
+}
+
+// timings records when each phase of each image started and ended. The phases of an image run
+// concurrently for each platform and tag, so their durations are elapsed time rather than a sum.
+type timings struct {
+	mu    sync.Mutex
+	spans map[string]map[string]*span
+}
+
+// Helper function to create an empty set of timings.
+func newTimings() *timings {
+	return &timings{
+		spans: make(map[string]map[string]*span),
+	}
+}
+
+// Helper function to record a phase of an image which ran from start until now.
+// Returns the duration of this run of the phase.
+func (t *timings) record(imageName, phase string, start time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	end := time.Now()
+
+	if t.spans[imageName] == nil {
+		t.spans[imageName] = make(map[string]*span)
+	}
+
+	if t.spans[imageName][phase] == nil {
+		t.spans[imageName][phase] = &span{}
+	}
+
+	t.spans[imageName][phase].add(start, end)
+
+	return end.Sub(start)
+}
+
+// Helper function to apply the elapsed time of each phase to the results.
+func (t *timings) apply(results map[string]ImageOutput) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for imageName, result := range results {
+		phases := t.spans[imageName]
+
+		var total span
+
+		for _, s := range phases {
+			total.add(s.start, s.end)
+		}
+
+		result.Duration = Duration(total.elapsed())
+		result.BuildDuration = Duration(phases[PhaseBuild].elapsed())
+		result.TagDuration = Duration(phases[phaseTag].elapsed())
+		result.PushDuration = Duration(phases[PhasePush].elapsed())
+
+		// Every other image waits for the compile image to be built.
+		if imageName != ImageNameCompile {
+			result.CompileDuration = Duration(t.spans[ImageNameCompile][PhaseBuild].elapsed())
+		}
+
+		results[imageName] = result
+	}
+}
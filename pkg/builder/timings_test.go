@@ -0,0 +1,53 @@
+package builder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimings(t *testing.T) {
+	start := time.Now()
+
+	timings := newTimings()
+
+	// Concurrent pushes of two tags are measured by elapsed time, rather than summed.
+	timings.spans["app"] = map[string]*span{
+		PhaseBuild: {start: start, end: start.Add(2 * time.Second)},
+		PhasePush:  {},
+	}
+	timings.spans["app"][PhasePush].add(start.Add(3*time.Second), start.Add(6*time.Second))
+	timings.spans["app"][PhasePush].add(start.Add(4*time.Second), start.Add(5*time.Second))
+
+	timings.spans["compile"] = map[string]*span{
+		PhaseBuild: {start: start, end: start.Add(time.Second)},
+	}
+
+	results := map[string]ImageOutput{
+		"app":     {Status: StatusPushed},
+		"compile": {Status: StatusBuilt},
+		"debug":   {Status: StatusSkipped},
+	}
+
+	timings.apply(results)
+
+	assert.Equal(t, map[string]ImageOutput{
+		"app": {
+			Status:          StatusPushed,
+			Duration:        Duration(6 * time.Second),
+			CompileDuration: Duration(time.Second),
+			BuildDuration:   Duration(2 * time.Second),
+			PushDuration:    Duration(3 * time.Second),
+		},
+		"compile": {
+			Status:        StatusBuilt,
+			Duration:      Duration(time.Second),
+			BuildDuration: Duration(time.Second),
+		},
+		"debug": {
+			Status:          StatusSkipped,
+			CompileDuration: Duration(time.Second),
+		},
+	}, results)
+}
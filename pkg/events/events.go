@@ -0,0 +1,304 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/pkg/jsonmessage"
+)
+
+// Type of an event.
+type Type string
+
+const (
+	// TypeLog is a line of output which does not have a more specific type.
+	TypeLog Type = "log"
+	// TypeStepStarted is a step of a Dockerfile which has started eg. "Step 2/5 : RUN make".
+	TypeStepStarted Type = "step-started"
+	// TypeStatus is a status update from the daemon eg. "Preparing" for a layer.
+	TypeStatus Type = "status"
+	// TypeLayerPushed is a layer which has been pushed to the registry.
+	TypeLayerPushed Type = "layer-pushed"
+	// TypeWarning is a warning reported by the daemon or the builder.
+	TypeWarning Type = "warning"
+	// TypeError is an error reported by the daemon, which fails the build or push.
+	TypeError Type = "error"
+)
+
+var (
+	// Steps reported by the classic builder eg. "Step 2/5 : RUN make".
+	stepRegex = regexp.MustCompile(`^Step (\d+)/(\d+) : (.*)$`)
+	// Steps reported by BuildKit with plain progress eg. "#7 [builder 2/5] RUN make".
+	buildKitStepRegex = regexp.MustCompile(`^#\d+ \[(?:\S+ )?(\d+)/(\d+)\] (.*)$`)
+	// Warnings eg. "[WARNING] ..." or "WARNING: ...".
+	warningRegex = regexp.MustCompile(`(?i)^\[?warn(ing)?\]?:?\s`)
+)
+
+// Event decoded from the output of a build or push.
+type Event struct {
+	// Time the event was published.
+	Time time.Time `json:"time"`
+	// Type of the event.
+	Type Type `json:"type"`
+	// Image the event relates to. Empty for events which relate to the whole run.
+	Image string `json:"image,omitempty"`
+	// Phase of the image eg. build or push. Empty when output is not decoded from the daemon.
+	Phase string `json:"phase,omitempty"`
+	// Step which started, starting from 1.
+	Step int `json:"step,omitempty"`
+	// Steps in the Dockerfile.
+	Steps int `json:"steps,omitempty"`
+	// Layer the event relates to eg. the ID of a layer which was pushed.
+	Layer string `json:"layer,omitempty"`
+	// Message of the event, without a trailing newline.
+	Message string `json:"message"`
+}
+
+// Publisher renders events and publishes them on a channel. Output written to the publisher
+// is published as events line by line, so it can be used where a writer is expected.
+type Publisher struct {
+	mu       sync.Mutex
+	renderer Renderer
+	channel  chan<- Event
+	done     <-chan struct{}
+	lines    lineBuffer
+}
+
+// NewPublisher of events. Events are sent on the channel, if it is not nil, which must be drained
+// until the context is done. The channel is not closed by the publisher.
+func NewPublisher(ctx context.Context, renderer Renderer, channel chan<- Event) *Publisher {
+	return &Publisher{
+		renderer: renderer,
+		channel:  channel,
+		done:     ctx.Done(),
+	}
+}
+
+// Publish an event, in the order events are published by concurrent builds and pushes.
+func (p *Publisher) Publish(event Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	if p.channel != nil {
+		select {
+		case p.channel <- event:
+		case <-p.done:
+		}
+	}
+
+	return p.renderer.Render(event)
+}
+
+// Write implements io.Writer, publishing each line as an event which relates to the whole run.
+func (p *Publisher) Write(b []byte) (int, error) {
+	return p.lines.write(b, func(line string) error {
+		return p.Publish(classify(line, "", ""))
+	})
+}
+
+// Image returns a writer which publishes each line as an event for an image.
+func (p *Publisher) Image(image string) *ImageWriter {
+	return &ImageWriter{
+		publisher: p,
+		image:     image,
+	}
+}
+
+// ImageWriter publishes output for an image as events.
+type ImageWriter struct {
+	publisher *Publisher
+	image     string
+	lines     lineBuffer
+}
+
+// Write implements io.Writer, publishing each line as an event.
+func (w *ImageWriter) Write(b []byte) (int, error) {
+	return w.lines.write(b, func(line string) error {
+		return w.publisher.Publish(classify(line, w.image, ""))
+	})
+}
+
+// Decoder of the Docker JSON message stream for a phase of the image eg. "build".
+func (w *ImageWriter) Decoder(phase string) *Decoder {
+	return &Decoder{
+		publisher: w.publisher,
+		image:     w.image,
+		phase:     phase,
+	}
+}
+
+// Decoder publishes a Docker JSON message stream written to it as events.
+type Decoder struct {
+	publisher *Publisher
+	image     string
+	phase     string
+	lines     lineBuffer
+	err       *jsonmessage.JSONError
+	// Aux is called with the auxiliary messages in the stream eg. the digest of a pushed image.
+	Aux func(aux json.RawMessage)
+}
+
+// Write implements io.Writer, decoding each message in the stream.
+func (d *Decoder) Write(b []byte) (int, error) {
+	return d.lines.write(b, d.decode)
+}
+
+// Close the decoder, decoding the final message if it was not terminated by a newline.
+func (d *Decoder) Close() error {
+	return d.lines.flush(d.decode)
+}
+
+// Err returns the first error reported by the stream, if any.
+func (d *Decoder) Err() error {
+	if d.err == nil {
+		return nil
+	}
+
+	return d.err
+}
+
+// Helper function to decode a single message and publish the events it contains.
+func (d *Decoder) decode(line string) error {
+	if strings.TrimSpace(line) == "" {
+		return nil
+	}
+
+	var msg jsonmessage.JSONMessage
+
+	// Output which is not part of the stream is published as is.
+	if err := json.Unmarshal([]byte(line), &msg); err != nil {
+		return d.publisher.Publish(classify(line, d.image, d.phase))
+	}
+
+	switch {
+	case msg.Error != nil:
+		if d.err == nil {
+			d.err = msg.Error
+		}
+
+		return d.publisher.Publish(Event{
+			Type:    TypeError,
+			Image:   d.image,
+			Phase:   d.phase,
+			Message: msg.Error.Message,
+		})
+
+	case msg.Aux != nil:
+		if d.Aux != nil {
+			d.Aux(*msg.Aux)
+		}
+
+		return nil
+
+	case msg.Stream != "":
+		for _, line := range strings.Split(strings.TrimSuffix(msg.Stream, "\n"), "\n") {
+			if err := d.publisher.Publish(classify(line, d.image, d.phase)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+
+	// Progress bars are only useful in a terminal.
+	case msg.Progress != nil && msg.Progress.String() != "":
+		return nil
+
+	case msg.Status == "Pushed" && msg.ID != "":
+		return d.publisher.Publish(Event{
+			Type:    TypeLayerPushed,
+			Image:   d.image,
+			Phase:   d.phase,
+			Layer:   msg.ID,
+			Message: msg.Status,
+		})
+
+	case msg.Status != "":
+		return d.publisher.Publish(Event{
+			Type:    TypeStatus,
+			Image:   d.image,
+			Phase:   d.phase,
+			Layer:   msg.ID,
+			Message: msg.Status,
+		})
+	}
+
+	return nil
+}
+
+// Helper function to determine the type of event for a line of output.
+func classify(line, image, phase string) Event {
+	event := Event{
+		Type:    TypeLog,
+		Image:   image,
+		Phase:   phase,
+		Message: strings.TrimSuffix(line, "\r"),
+	}
+
+	for _, regex := range []*regexp.Regexp{stepRegex, buildKitStepRegex} {
+		if match := regex.FindStringSubmatch(event.Message); match != nil {
+			event.Type = TypeStepStarted
+			event.Step, _ = strconv.Atoi(match[1])
+			event.Steps, _ = strconv.Atoi(match[2])
+			return event
+		}
+	}
+
+	if warningRegex.MatchString(event.Message) {
+		event.Type = TypeWarning
+	}
+
+	return event
+}
+
+// lineBuffer splits output into lines, holding back a line until it has been terminated.
+type lineBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+// Helper function to buffer output, calling fn with each complete line.
+func (l *lineBuffer) write(b []byte, fn func(line string) error) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.buf = append(l.buf, b...)
+
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+
+		line := string(l.buf[:i])
+		l.buf = l.buf[i+1:]
+
+		if err := fn(line); err != nil {
+			return len(b), err
+		}
+	}
+}
+
+// Helper function to call fn with the remaining output, if it was not terminated.
+func (l *lineBuffer) flush(fn func(line string) error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.buf) == 0 {
+		return nil
+	}
+
+	line := string(l.buf)
+	l.buf = nil
+
+	return fn(line)
+}
@@ -0,0 +1,105 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/stretchr/testify/assert"
+)
+
+// recorder keeps the events which were rendered.
+type recorder struct {
+	events []Event
+}
+
+func (r *recorder) Render(event Event) error {
+	r.events = append(r.events, event)
+	return nil
+}
+
+func TestDecoder(t *testing.T) {
+	r := &recorder{}
+	channel := make(chan Event, 100)
+
+	publisher := NewPublisher(context.Background(), r, channel)
+
+	stream := publisher.Image("app").Decoder("build")
+
+	var aux []string
+
+	stream.Aux = func(msg json.RawMessage) {
+		aux = append(aux, string(msg))
+	}
+
+	// Messages may be split across writes.
+	fmt.Fprint(stream, `{"stream":"Step 1/2 : FROM alpine\n"}`+"\r\n"+`{"stream":" ---> abc123\n"}`+"\r\n"+`{"stream":"[WARNING]: Empty continuation line\n"}`+"\r\n"+`{"status":"Pushing","progressDetail":{"current":1,"total":2},"id":"def456"}`+"\r\n"+`{"status":"Pushed","progressDetail":{},"id":"def456"}`+"\r\n"+`{"status":"Preparing","progressDetail":{},"id":"ghi789"}`+"\r\n"+`{"aux":{"ID":"sha256:abc123"}}`+"\r\n"+`{"errorDetail":{"code":503,"message":"service unavailable"},"error":"service unavailable"}`)
+	fmt.Fprint(stream, "\r\n")
+	fmt.Fprint(stream, "not json")
+
+	assert.NoError(t, stream.Close())
+
+	var status *jsonmessage.JSONError
+	assert.ErrorAs(t, stream.Err(), &status)
+	assert.Equal(t, 503, status.Code)
+
+	assert.Equal(t, []string{`{"ID":"sha256:abc123"}`}, aux)
+
+	// Events are timestamped when they are published.
+	for i := range r.events {
+		assert.False(t, r.events[i].Time.IsZero())
+		r.events[i].Time = time.Time{}
+	}
+
+	expected := []Event{
+		{Type: TypeStepStarted, Image: "app", Phase: "build", Step: 1, Steps: 2, Message: "Step 1/2 : FROM alpine"},
+		{Type: TypeLog, Image: "app", Phase: "build", Message: " ---> abc123"},
+		{Type: TypeWarning, Image: "app", Phase: "build", Message: "[WARNING]: Empty continuation line"},
+		{Type: TypeLayerPushed, Image: "app", Phase: "build", Layer: "def456", Message: "Pushed"},
+		{Type: TypeStatus, Image: "app", Phase: "build", Layer: "ghi789", Message: "Preparing"},
+		{Type: TypeError, Image: "app", Phase: "build", Message: "service unavailable"},
+		{Type: TypeLog, Image: "app", Phase: "build", Message: "not json"},
+	}
+
+	assert.Equal(t, expected, r.events)
+
+	// The same events are published on the channel.
+	assert.Len(t, channel, len(expected))
+}
+
+func TestPublisherWrite(t *testing.T) {
+	r := &recorder{}
+
+	publisher := NewPublisher(context.Background(), r, nil)
+
+	fmt.Fprint(publisher, "Building image: foo:222-app\n")
+	fmt.Fprint(publisher.Image("app"), "#7 [builder 2/5] RUN make\nWARNING: no cache\npartial")
+
+	assert.Len(t, r.events, 3)
+
+	assert.Equal(t, TypeLog, r.events[0].Type)
+	assert.Equal(t, "", r.events[0].Image)
+	assert.Equal(t, "Building image: foo:222-app", r.events[0].Message)
+
+	assert.Equal(t, TypeStepStarted, r.events[1].Type)
+	assert.Equal(t, "app", r.events[1].Image)
+	assert.Equal(t, 2, r.events[1].Step)
+	assert.Equal(t, 5, r.events[1].Steps)
+
+	assert.Equal(t, TypeWarning, r.events[2].Type)
+}
+
+func TestPublisherCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r := &recorder{}
+
+	// Events are still rendered once nothing is draining the channel.
+	publisher := NewPublisher(ctx, r, make(chan Event))
+	assert.NoError(t, publisher.Publish(Event{Type: TypeLog, Message: "interrupted"}))
+	assert.Len(t, r.events, 1)
+}
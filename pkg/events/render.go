@@ -0,0 +1,147 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/skpr/package/pkg/color"
+)
+
+const (
+	// FormatText renders events as plain text, prefixed with the image.
+	FormatText = "text"
+	// FormatJSON renders events as JSON lines.
+	FormatJSON = "json"
+	// FormatGitHub renders warnings and errors as GitHub Actions annotations.
+	FormatGitHub = "github"
+	// FormatAzure renders warnings and errors as Azure Pipelines logging commands.
+	FormatAzure = "azure"
+)
+
+// Renderer of events.
+type Renderer interface {
+	Render(event Event) error
+}
+
+// NewRenderer for a format eg. FormatJSON.
+func NewRenderer(format string, w io.Writer) (Renderer, error) {
+	switch format {
+	case FormatText, "":
+		return Text{Writer: w}, nil
+	case FormatJSON:
+		return JSON{Writer: w}, nil
+	case FormatGitHub:
+		return GitHub{Text: Text{Writer: w}}, nil
+	case FormatAzure:
+		return Azure{Text: Text{Writer: w}}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported event format: %s", format)
+}
+
+// Text renders events as plain text, prefixed with the image.
+type Text struct {
+	Writer io.Writer
+}
+
+// Render implements the Renderer interface.
+func (r Text) Render(event Event) error {
+	message := event.Message
+
+	if event.Layer != "" {
+		message = fmt.Sprintf("%s: %s", event.Layer, message)
+	}
+
+	if event.Image == "" {
+		_, err := fmt.Fprintln(r.Writer, message)
+		return err
+	}
+
+	_, err := fmt.Fprintf(r.Writer, "%s\t%s\n", color.Wrap(strings.ToUpper(event.Image)), message)
+
+	return err
+}
+
+// JSON renders events as JSON lines.
+type JSON struct {
+	Writer io.Writer
+}
+
+// Render implements the Renderer interface.
+func (r JSON) Render(event Event) error {
+	return json.NewEncoder(r.Writer).Encode(event)
+}
+
+// GitHub renders warnings and errors as annotations, which are shown in the summary of a workflow run.
+// Other events are rendered as text.
+// https://docs.github.com/en/actions/using-workflows/workflow-commands-for-github-actions
+type GitHub struct {
+	Text
+}
+
+// Render implements the Renderer interface.
+func (r GitHub) Render(event Event) error {
+	var command string
+
+	switch event.Type {
+	case TypeWarning:
+		command = "warning"
+	case TypeError:
+		command = "error"
+	default:
+		return r.Text.Render(event)
+	}
+
+	if event.Image == "" {
+		_, err := fmt.Fprintf(r.Writer, "::%s::%s\n", command, escapeGitHub(event.Message, false))
+		return err
+	}
+
+	_, err := fmt.Fprintf(r.Writer, "::%s title=%s::%s\n", command, escapeGitHub(event.Image, true), escapeGitHub(event.Message, false))
+
+	return err
+}
+
+// Helper function to escape the data or a property of a GitHub Actions workflow command.
+func escapeGitHub(value string, property bool) string {
+	value = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(value)
+
+	if property {
+		value = strings.NewReplacer(":", "%3A", ",", "%2C").Replace(value)
+	}
+
+	return value
+}
+
+// Azure renders warnings and errors as issues, which are shown in the summary of a pipeline run.
+// Other events are rendered as text.
+// https://learn.microsoft.com/en-us/azure/devops/pipelines/scripts/logging-commands
+type Azure struct {
+	Text
+}
+
+// Render implements the Renderer interface.
+func (r Azure) Render(event Event) error {
+	var issue string
+
+	switch event.Type {
+	case TypeWarning:
+		issue = "warning"
+	case TypeError:
+		issue = "error"
+	default:
+		return r.Text.Render(event)
+	}
+
+	message := strings.NewReplacer("%", "%AZP25", "\r", "%0D", "\n", "%0A", ";", "%3B", "]", "%5D").Replace(event.Message)
+
+	if event.Image != "" {
+		message = fmt.Sprintf("%s: %s", event.Image, message)
+	}
+
+	_, err := fmt.Fprintf(r.Writer, "##vso[task.logissue type=%s]%s\n", issue, message)
+
+	return err
+}
@@ -0,0 +1,71 @@
+package events
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skpr/package/pkg/color"
+)
+
+func TestRenderers(t *testing.T) {
+	t.Setenv(color.EnvNoColor, "1")
+
+	events := []Event{
+		{Type: TypeLog, Message: "Building image: foo:222-app"},
+		{Type: TypeLayerPushed, Image: "app", Phase: "push", Layer: "abc123", Message: "Pushed"},
+		{Type: TypeWarning, Image: "app", Phase: "build", Message: "[WARNING]: 50% done"},
+		{Type: TypeError, Image: "app", Phase: "push", Message: "denied: access\nto the resource"},
+	}
+
+	for format, expected := range map[string]string{
+		FormatText: `Building image: foo:222-app
+APP	abc123: Pushed
+APP	[WARNING]: 50% done
+APP	denied: access
+to the resource
+`,
+		FormatGitHub: `Building image: foo:222-app
+APP	abc123: Pushed
+::warning title=app::[WARNING]: 50%25 done
+::error title=app::denied: access%0Ato the resource
+`,
+		FormatAzure: `Building image: foo:222-app
+APP	abc123: Pushed
+##vso[task.logissue type=warning]app: [WARNING%5D: 50%AZP25 done
+##vso[task.logissue type=error]app: denied: access%0Ato the resource
+`,
+	} {
+		var b bytes.Buffer
+
+		renderer, err := NewRenderer(format, &b)
+		assert.NoError(t, err)
+
+		for _, event := range events {
+			assert.NoError(t, renderer.Render(event))
+		}
+
+		assert.Equal(t, expected, b.String(), format)
+	}
+
+	_, err := NewRenderer("xml", nil)
+	assert.Error(t, err)
+}
+
+func TestRenderJSON(t *testing.T) {
+	var b bytes.Buffer
+
+	assert.NoError(t, JSON{Writer: &b}.Render(Event{
+		Time:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Type:    TypeStepStarted,
+		Image:   "app",
+		Phase:   "build",
+		Step:    1,
+		Steps:   2,
+		Message: "Step 1/2 : FROM alpine",
+	}))
+
+	assert.Equal(t, `{"time":"2024-01-01T00:00:00Z","type":"step-started","image":"app","phase":"build","step":1,"steps":2,"message":"Step 1/2 : FROM alpine"}`+"\n", b.String())
+}
@@ -3,11 +3,13 @@ package ecr
 import (
 	"context"
 	"fmt"
-	"strings"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 	docker "github.com/fsouza/go-dockerclient"
 	"github.com/pkg/errors"
 )
@@ -16,30 +18,56 @@ import (
 // https://docs.aws.amazon.com/cli/latest/reference/ecr/get-authorization-token.html
 const Username = "AWS"
 
+// RoleSessionName used when assuming a role.
+const RoleSessionName = "skpr-package"
+
+// Provider of AWS ECR authentication.
+type Provider struct {
+	// Profile from the shared AWS config used by the default credential chain.
+	Profile string
+	// RoleARN to assume before requesting a token eg. for a registry in another account.
+	RoleARN string
+	// Endpoint overrides the AWS API endpoints (ECR and STS).
+	Endpoint string
+	// Repository settings applied when a repository is created.
+	Repository RepositoryConfig
+}
+
 // IsRegistry managed by AWS ECR.
 func IsRegistry(registry string) bool {
-	return strings.Contains(registry, ".ecr.")
+	_, err := ParseReference(registry)
+	return err == nil
 }
 
 // UpgradeAuth to use an AWS IAM token for authentication..
 // https://docs.aws.amazon.com/cli/latest/reference/ecr/get-login.html
-func UpgradeAuth(url string, auth docker.AuthConfiguration) (docker.AuthConfiguration, error) {
-	region, err := extractRegionFromURL(url)
+func UpgradeAuth(ctx context.Context, url string, auth docker.AuthConfiguration) (docker.AuthConfiguration, error) {
+	return Provider{}.Upgrade(ctx, url, auth)
+}
+
+// Name implements the registry.Provider interface.
+func (p Provider) Name() string {
+	return "ecr"
+}
+
+// Upgrade implements the registry.Provider interface.
+// The Docker username and password are used as static AWS credentials when both are provided,
+// otherwise the SDK's default credential chain is used eg. environment, IRSA, SSO or instance profiles.
+func (p Provider) Upgrade(ctx context.Context, url string, auth docker.AuthConfiguration) (docker.AuthConfiguration, error) {
+	ref, err := ParseReference(url)
 	if err != nil {
-		return auth, errors.Wrap(err, "failed to determine registry region")
-	}
-	ctx := context.TODO()
-	cfg, err := config.LoadDefaultConfig(
-		ctx,
-		config.WithRegion(region),
-		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(auth.Username, auth.Password, "")),
-	)
+		return auth, errors.Wrap(err, "failed to parse registry")
+	}
+	cfg, err := p.loadConfig(ctx, ref, auth)
 	if err != nil {
-		return auth, fmt.Errorf("failed to get session: %w", err)
+		return auth, err
 	}
 	ecrClient := ecr.NewFromConfig(cfg)
 
-	res, err := ecrClient.GetAuthorizationToken(ctx, &ecr.GetAuthorizationTokenInput{})
+	// Request a token for the registry being pushed to, which may belong to another account.
+	res, err := ecrClient.GetAuthorizationToken(ctx, &ecr.GetAuthorizationTokenInput{
+		RegistryIds: []string{ref.AccountID},
+	})
 	if err != nil {
 		return auth, err
 	}
@@ -61,3 +89,37 @@ func UpgradeAuth(url string, auth docker.AuthConfiguration) (docker.AuthConfigur
 
 	return auth, nil
 }
+
+// Helper function to load the AWS config for a registry.
+func (p Provider) loadConfig(ctx context.Context, ref Reference, auth docker.AuthConfiguration) (aws.Config, error) {
+	opts := []func(*config.LoadOptions) error{
+		config.WithRegion(ref.Region),
+	}
+	if auth.Username != "" && auth.Password != "" {
+		opts = append(opts, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(auth.Username, auth.Password, "")))
+	}
+	if p.Profile != "" {
+		opts = append(opts, config.WithSharedConfigProfile(p.Profile))
+	}
+	if ref.FIPS {
+		opts = append(opts, config.WithUseFIPSEndpoint(aws.FIPSEndpointStateEnabled))
+	}
+	if ref.DualStack {
+		opts = append(opts, config.WithUseDualStackEndpoint(aws.DualStackEndpointStateEnabled))
+	}
+	if p.Endpoint != "" {
+		opts = append(opts, config.WithEndpointResolverWithOptions(aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (aws.Endpoint, error) {
+			return aws.Endpoint{URL: p.Endpoint, SigningRegion: region}, nil
+		})))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to get session: %w", err)
+	}
+	if p.RoleARN != "" {
+		cfg.Credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), p.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = RoleSessionName
+		}))
+	}
+	return cfg, nil
+}
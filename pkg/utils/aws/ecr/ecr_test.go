@@ -0,0 +1,87 @@
+package ecr
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+// Helper function to create a local stand-in for the ECR and STS APIs.
+func newServer(t *testing.T, accessKey string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") == "" {
+			assert.NoError(t, r.ParseForm())
+			assert.Equal(t, "AssumeRole", r.PostForm.Get("Action"))
+			assert.Equal(t, "arn:aws:iam::210987654321:role/push", r.PostForm.Get("RoleArn"))
+			assert.Equal(t, RoleSessionName, r.PostForm.Get("RoleSessionName"))
+			w.Header().Set("Content-Type", "text/xml")
+			fmt.Fprint(w, `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>ASIAASSUMED</AccessKeyId>
+      <SecretAccessKey>secret</SecretAccessKey>
+      <SessionToken>token</SessionToken>
+      <Expiration>2099-01-01T00:00:00Z</Expiration>
+    </Credentials>
+  </AssumeRoleResult>
+</AssumeRoleResponse>`)
+			return
+		}
+
+		assert.Equal(t, "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken", r.Header.Get("X-Amz-Target"))
+		assert.Contains(t, r.Header.Get("Authorization"), fmt.Sprintf("Credential=%s/", accessKey))
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		fmt.Fprintf(w, `{"authorizationData": [{"authorizationToken": "%s"}]}`, base64.StdEncoding.EncodeToString([]byte("AWS:password")))
+	}))
+}
+
+func TestUpgrade(t *testing.T) {
+	server := newServer(t, "AKIAEXAMPLE")
+	defer server.Close()
+
+	provider := Provider{Endpoint: server.URL}
+
+	auth, err := provider.Upgrade(context.Background(), "123456789012.dkr.ecr.ap-southeast-2.amazonaws.com/app", docker.AuthConfiguration{
+		Username: "AKIAEXAMPLE",
+		Password: "secret",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, docker.AuthConfiguration{Username: Username, Password: "password"}, auth)
+}
+
+func TestUpgradeDefaultCredentials(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIAENVIRONMENT")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	server := newServer(t, "AKIAENVIRONMENT")
+	defer server.Close()
+
+	provider := Provider{Endpoint: server.URL}
+
+	auth, err := provider.Upgrade(context.Background(), "123456789012.dkr.ecr.eu-west-1.amazonaws.com/app", docker.AuthConfiguration{})
+	assert.NoError(t, err)
+	assert.Equal(t, docker.AuthConfiguration{Username: Username, Password: "password"}, auth)
+}
+
+func TestUpgradeAssumeRole(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIAENVIRONMENT")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	server := newServer(t, "ASIAASSUMED")
+	defer server.Close()
+
+	provider := Provider{
+		RoleARN:  "arn:aws:iam::210987654321:role/push",
+		Endpoint: server.URL,
+	}
+
+	auth, err := provider.Upgrade(context.Background(), "210987654321.dkr.ecr.us-east-1.amazonaws.com/app", docker.AuthConfiguration{})
+	assert.NoError(t, err)
+	assert.Equal(t, docker.AuthConfiguration{Username: Username, Password: "password"}, auth)
+}
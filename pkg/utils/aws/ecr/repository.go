@@ -0,0 +1,117 @@
+package ecr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// RepositoryConfig applied when a repository is created.
+type RepositoryConfig struct {
+	// ImmutableTags prevents tags from being overwritten.
+	ImmutableTags bool
+	// ScanOnPush enables basic image scanning.
+	ScanOnPush bool
+	// EncryptionType is either "AES256" or "KMS". Defaults to "AES256".
+	EncryptionType string
+	// KMSKey used when the encryption type is "KMS". Defaults to the AWS managed key.
+	KMSKey string
+	// LifecyclePolicyFile is a path to a JSON lifecycle policy.
+	LifecyclePolicyFile string
+}
+
+// EnsureRepository creates the repository for a registry if it does not exist.
+// Returns true if the repository was created.
+func (p Provider) EnsureRepository(ctx context.Context, registry string, auth docker.AuthConfiguration) (bool, error) {
+	ref, err := ParseReference(registry)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse registry: %w", err)
+	}
+
+	if ref.Repository == "" {
+		return false, fmt.Errorf("registry does not include a repository: %s", registry)
+	}
+
+	var policy string
+
+	if p.Repository.LifecyclePolicyFile != "" {
+		data, err := os.ReadFile(p.Repository.LifecyclePolicyFile)
+		if err != nil {
+			return false, fmt.Errorf("failed to read lifecycle policy: %w", err)
+		}
+
+		if !json.Valid(data) {
+			return false, fmt.Errorf("lifecycle policy is not valid JSON: %s", p.Repository.LifecyclePolicyFile)
+		}
+
+		policy = string(data)
+	}
+
+	cfg, err := p.loadConfig(ctx, ref, auth)
+	if err != nil {
+		return false, err
+	}
+
+	client := ecr.NewFromConfig(cfg)
+
+	_, err = client.DescribeRepositories(ctx, &ecr.DescribeRepositoriesInput{
+		RegistryId:      aws.String(ref.AccountID),
+		RepositoryNames: []string{ref.Repository},
+	})
+	if err == nil {
+		return false, nil
+	}
+
+	var notFound *types.RepositoryNotFoundException
+	if !errors.As(err, &notFound) {
+		return false, fmt.Errorf("failed to describe repository: %w", err)
+	}
+
+	input := &ecr.CreateRepositoryInput{
+		RegistryId:         aws.String(ref.AccountID),
+		RepositoryName:     aws.String(ref.Repository),
+		ImageTagMutability: types.ImageTagMutabilityMutable,
+		ImageScanningConfiguration: &types.ImageScanningConfiguration{
+			ScanOnPush: p.Repository.ScanOnPush,
+		},
+	}
+
+	if p.Repository.ImmutableTags {
+		input.ImageTagMutability = types.ImageTagMutabilityImmutable
+	}
+
+	if p.Repository.EncryptionType != "" {
+		input.EncryptionConfiguration = &types.EncryptionConfiguration{
+			EncryptionType: types.EncryptionType(p.Repository.EncryptionType),
+		}
+
+		if p.Repository.KMSKey != "" {
+			input.EncryptionConfiguration.KmsKey = aws.String(p.Repository.KMSKey)
+		}
+	}
+
+	_, err = client.CreateRepository(ctx, input)
+	if err != nil {
+		return false, fmt.Errorf("failed to create repository: %w", err)
+	}
+
+	if policy != "" {
+		_, err = client.PutLifecyclePolicy(ctx, &ecr.PutLifecyclePolicyInput{
+			RegistryId:          aws.String(ref.AccountID),
+			RepositoryName:      aws.String(ref.Repository),
+			LifecyclePolicyText: aws.String(policy),
+		})
+		if err != nil {
+			return true, fmt.Errorf("failed to put lifecycle policy: %w", err)
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,100 @@
+package ecr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeECR is a local stand-in for the ECR repository APIs.
+type fakeECR struct {
+	mu           sync.Mutex
+	repositories map[string]map[string]interface{}
+	policies     map[string]string
+}
+
+func (f *fakeECR) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var body map[string]interface{}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+
+	switch strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "AmazonEC2ContainerRegistry_V20150921.") {
+	case "DescribeRepositories":
+		name := body["repositoryNames"].([]interface{})[0].(string)
+		if _, ok := f.repositories[name]; !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `{"__type": "RepositoryNotFoundException", "message": "The repository with name '%s' does not exist"}`, name)
+			return
+		}
+		fmt.Fprintf(w, `{"repositories": [{"repositoryName": "%s"}]}`, name)
+	case "CreateRepository":
+		f.repositories[body["repositoryName"].(string)] = body
+		fmt.Fprintf(w, `{"repository": {"repositoryName": "%s"}}`, body["repositoryName"])
+	case "PutLifecyclePolicy":
+		f.policies[body["repositoryName"].(string)] = body["lifecyclePolicyText"].(string)
+		fmt.Fprintf(w, `{"repositoryName": "%s"}`, body["repositoryName"])
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"__type": "InvalidParameterException", "message": "unsupported"}`)
+	}
+}
+
+func TestEnsureRepository(t *testing.T) {
+	fake := &fakeECR{
+		repositories: map[string]map[string]interface{}{
+			"existing": {},
+		},
+		policies: map[string]string{},
+	}
+
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	provider := Provider{
+		Endpoint: server.URL,
+		Repository: RepositoryConfig{
+			ImmutableTags:       true,
+			ScanOnPush:          true,
+			EncryptionType:      "KMS",
+			KMSKey:              "alias/ecr",
+			LifecyclePolicyFile: "testdata/lifecycle.json",
+		},
+	}
+
+	auth := docker.AuthConfiguration{
+		Username: "AKIAEXAMPLE",
+		Password: "secret",
+	}
+
+	created, err := provider.EnsureRepository(context.Background(), "123456789012.dkr.ecr.ap-southeast-2.amazonaws.com/existing", auth)
+	assert.NoError(t, err)
+	assert.False(t, created)
+
+	created, err = provider.EnsureRepository(context.Background(), "123456789012.dkr.ecr.ap-southeast-2.amazonaws.com/app", auth)
+	assert.NoError(t, err)
+	assert.True(t, created)
+
+	assert.Equal(t, "IMMUTABLE", fake.repositories["app"]["imageTagMutability"])
+	assert.Equal(t, map[string]interface{}{"scanOnPush": true}, fake.repositories["app"]["imageScanningConfiguration"])
+	assert.Equal(t, map[string]interface{}{"encryptionType": "KMS", "kmsKey": "alias/ecr"}, fake.repositories["app"]["encryptionConfiguration"])
+
+	policy, err := os.ReadFile("testdata/lifecycle.json")
+	assert.NoError(t, err)
+	assert.Equal(t, string(policy), fake.policies["app"])
+
+	_, err = provider.EnsureRepository(context.Background(), "123456789012.dkr.ecr.ap-southeast-2.amazonaws.com", auth)
+	assert.Error(t, err)
+}
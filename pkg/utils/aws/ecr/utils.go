@@ -3,18 +3,128 @@ package ecr
 import (
 	"encoding/base64"
 	"fmt"
+	"regexp"
 	"strings"
 
 	"github.com/pkg/errors"
 )
 
 const (
-	// RegionUsEast1 identifies the US region.
-	RegionUsEast1 = "us-east-1"
-	// RegionApSouthEast2 identifies the Australia region.
-	RegionApSouthEast2 = "ap-southeast-2"
+	// PartitionAWS identifies the standard AWS partition.
+	PartitionAWS = "aws"
+	// PartitionChina identifies the AWS China partition.
+	PartitionChina = "aws-cn"
+	// PartitionGovCloud identifies the AWS GovCloud (US) partition.
+	PartitionGovCloud = "aws-us-gov"
+	// PartitionISO identifies the AWS ISO partition.
+	PartitionISO = "aws-iso"
+	// PartitionISOB identifies the AWS ISOB partition.
+	PartitionISOB = "aws-iso-b"
 )
 
+// Matches registry hostnames eg.
+//
+//	123456789012.dkr.ecr.ap-southeast-2.amazonaws.com
+//	123456789012.dkr.ecr-fips.us-gov-west-1.amazonaws.com
+//	123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn
+//	123456789012.dkr-ecr.eu-west-1.on.aws
+var hostnameRegex = regexp.MustCompile(`^([0-9]{12})\.dkr([.-])ecr(-fips)?\.([a-z0-9-]+)\.(amazonaws\.com|amazonaws\.com\.cn|on\.aws|c2s\.ic\.gov|sc2s\.sgov\.gov)$`)
+
+// Reference to an ECR registry and repository.
+type Reference struct {
+	AccountID  string
+	Region     string
+	Partition  string
+	FIPS       bool
+	DualStack  bool
+	Repository string
+}
+
+// ParseReference from a registry eg. "123456789012.dkr.ecr.ap-southeast-2.amazonaws.com/app".
+func ParseReference(registry string) (Reference, error) {
+	var ref Reference
+
+	parts := strings.SplitN(registry, "/", 2)
+	if len(parts) == 2 {
+		ref.Repository = parts[1]
+	}
+
+	matches := hostnameRegex.FindStringSubmatch(parts[0])
+	if matches == nil {
+		return ref, fmt.Errorf("not an ECR registry: %s", registry)
+	}
+
+	ref.AccountID = matches[1]
+	ref.FIPS = matches[3] != ""
+	ref.Region = matches[4]
+
+	switch matches[5] {
+	case "amazonaws.com.cn":
+		ref.Partition = PartitionChina
+	case "c2s.ic.gov":
+		ref.Partition = PartitionISO
+	case "sc2s.sgov.gov":
+		ref.Partition = PartitionISOB
+	case "on.aws":
+		ref.DualStack = true
+		ref.Partition = partitionForRegion(ref.Region)
+	default:
+		ref.Partition = partitionForRegion(ref.Region)
+	}
+
+	// Dual-stack endpoints use a dash separator eg. dkr-ecr.
+	if (matches[2] == "-") != ref.DualStack {
+		return ref, fmt.Errorf("not an ECR registry: %s", registry)
+	}
+
+	return ref, nil
+}
+
+// Hostname of the registry.
+func (r Reference) Hostname() string {
+	service := "dkr.ecr"
+	if r.DualStack {
+		service = "dkr-ecr"
+	}
+
+	if r.FIPS {
+		service = fmt.Sprintf("%s-fips", service)
+	}
+
+	var domain string
+
+	switch {
+	case r.DualStack:
+		domain = "on.aws"
+	case r.Partition == PartitionChina:
+		domain = "amazonaws.com.cn"
+	case r.Partition == PartitionISO:
+		domain = "c2s.ic.gov"
+	case r.Partition == PartitionISOB:
+		domain = "sc2s.sgov.gov"
+	default:
+		domain = "amazonaws.com"
+	}
+
+	return fmt.Sprintf("%s.%s.%s.%s", r.AccountID, service, r.Region, domain)
+}
+
+// Helper function to derive a partition from a region.
+func partitionForRegion(region string) string {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return PartitionChina
+	case strings.HasPrefix(region, "us-gov-"):
+		return PartitionGovCloud
+	case strings.HasPrefix(region, "us-iso-"):
+		return PartitionISO
+	case strings.HasPrefix(region, "us-isob-"):
+		return PartitionISOB
+	}
+
+	return PartitionAWS
+}
+
 // Helper function to convert a base64 token to a string.
 func decodeAuthorizationToken(auth string) (string, error) {
 	decoded, err := base64.StdEncoding.DecodeString(auth)
@@ -29,19 +139,3 @@ func decodeAuthorizationToken(auth string) (string, error) {
 
 	return parts[1], nil
 }
-
-// Helper function to derive a region for a URL.
-func extractRegionFromURL(url string) (string, error) {
-	regions := []string{
-		RegionUsEast1,
-		RegionApSouthEast2,
-	}
-
-	for _, region := range regions {
-		if strings.Contains(url, region) {
-			return region, nil
-		}
-	}
-
-	return "", fmt.Errorf("region not found for url: %s", url)
-}
@@ -7,14 +7,79 @@ import (
 )
 
 func TestIsRegistry(t *testing.T) {
-	assert.True(t, IsRegistry("example.ecr.amazon.com"))
+	assert.True(t, IsRegistry("123456789012.dkr.ecr.eu-west-1.amazonaws.com/app"))
+	assert.False(t, IsRegistry("example.ecr.amazon.com"))
+	assert.False(t, IsRegistry("docker.io/skpr/app"))
 }
 
-func TestExtractRegionFromURL(t *testing.T) {
-	region, err := extractRegionFromURL("example.ap-southeast-2.aws.amazon.com")
-	assert.Nil(t, err)
-	assert.Equal(t, "ap-southeast-2", region)
+func TestParseReference(t *testing.T) {
+	tests := map[string]Reference{
+		"123456789012.dkr.ecr.ap-southeast-2.amazonaws.com/app": {
+			AccountID:  "123456789012",
+			Region:     "ap-southeast-2",
+			Partition:  PartitionAWS,
+			Repository: "app",
+		},
+		"123456789012.dkr.ecr.eu-west-1.amazonaws.com": {
+			AccountID: "123456789012",
+			Region:    "eu-west-1",
+			Partition: PartitionAWS,
+		},
+		"123456789012.dkr.ecr-fips.us-gov-west-1.amazonaws.com/team/app": {
+			AccountID:  "123456789012",
+			Region:     "us-gov-west-1",
+			Partition:  PartitionGovCloud,
+			FIPS:       true,
+			Repository: "team/app",
+		},
+		"123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn/app": {
+			AccountID:  "123456789012",
+			Region:     "cn-north-1",
+			Partition:  PartitionChina,
+			Repository: "app",
+		},
+		"123456789012.dkr-ecr.us-east-1.on.aws/app": {
+			AccountID:  "123456789012",
+			Region:     "us-east-1",
+			Partition:  PartitionAWS,
+			DualStack:  true,
+			Repository: "app",
+		},
+		"123456789012.dkr-ecr-fips.us-east-2.on.aws/app": {
+			AccountID:  "123456789012",
+			Region:     "us-east-2",
+			Partition:  PartitionAWS,
+			DualStack:  true,
+			FIPS:       true,
+			Repository: "app",
+		},
+		"123456789012.dkr.ecr.us-iso-east-1.c2s.ic.gov/app": {
+			AccountID:  "123456789012",
+			Region:     "us-iso-east-1",
+			Partition:  PartitionISO,
+			Repository: "app",
+		},
+	}
 
-	_, err = extractRegionFromURL("example.nope.aws.amazon.com")
-	assert.NotNil(t, err)
+	for registry, want := range tests {
+		ref, err := ParseReference(registry)
+		assert.NoError(t, err, registry)
+		assert.Equal(t, want, ref, registry)
+
+		hostname := registry
+		if want.Repository != "" {
+			hostname = registry[:len(registry)-len(want.Repository)-1]
+		}
+		assert.Equal(t, hostname, ref.Hostname(), registry)
+	}
+
+	for _, registry := range []string{
+		"example.ap-southeast-2.aws.amazon.com",
+		"12345.dkr.ecr.us-east-1.amazonaws.com",
+		"123456789012.dkr-ecr.us-east-1.amazonaws.com",
+		"123456789012.dkr.ecr.us-east-1.on.aws",
+	} {
+		_, err := ParseReference(registry)
+		assert.Error(t, err, registry)
+	}
 }
@@ -0,0 +1,164 @@
+package acr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+const (
+	// Username to pass to the Docker registry when authenticating with a refresh token.
+	// https://github.com/Azure/acr/blob/main/docs/AAD-OAuth.md
+	Username = "00000000-0000-0000-0000-000000000000"
+
+	// IMDSURL used to request an Azure AD token for a managed identity.
+	IMDSURL = "http://169.254.169.254/metadata/identity/oauth2/token"
+	// IMDSResource requested from the instance metadata service.
+	IMDSResource = "https://management.azure.com/"
+)
+
+// Used for requests when a client has not been configured. Requests time out, so a metadata service
+// which cannot be reached eg. on a developer machine does not hang the build.
+var defaultClient = &http.Client{Timeout: 30 * time.Second}
+
+// Provider of Azure Container Registry authentication.
+type Provider struct {
+	// IMDSURL overrides the instance metadata service endpoint.
+	IMDSURL string
+	// Client used for requests. Defaults to a client which times out after 30 seconds.
+	Client *http.Client
+}
+
+// Name implements the registry.Provider interface.
+func (p Provider) Name() string {
+	return "acr"
+}
+
+// Upgrade implements the registry.Provider interface.
+// Service principal credentials are passed through, a bare password is treated as an Azure AD token
+// and an Azure AD token is requested for the managed identity when no credentials are provided.
+// The Azure AD token is then exchanged for an ACR refresh token.
+func (p Provider) Upgrade(ctx context.Context, registry string, auth docker.AuthConfiguration) (docker.AuthConfiguration, error) {
+	if auth.Username != "" {
+		return auth, nil
+	}
+
+	aad := auth.Password
+
+	if aad == "" {
+		token, err := p.managedIdentityToken(ctx)
+		if err != nil {
+			return auth, fmt.Errorf("failed to get managed identity token: %w", err)
+		}
+
+		aad = token
+	}
+
+	refresh, err := p.exchange(ctx, strings.SplitN(registry, "/", 2)[0], aad)
+	if err != nil {
+		return auth, fmt.Errorf("failed to exchange token: %w", err)
+	}
+
+	auth.Username = Username
+	auth.Password = refresh
+
+	return auth, nil
+}
+
+// Helper function to return the configured client.
+func (p Provider) client() *http.Client {
+	if p.Client == nil {
+		return defaultClient
+	}
+
+	return p.Client
+}
+
+// Helper function to request an Azure AD token from the instance metadata service.
+func (p Provider) managedIdentityToken(ctx context.Context) (string, error) {
+	endpoint := p.IMDSURL
+	if endpoint == "" {
+		endpoint = IMDSURL
+	}
+
+	query := url.Values{}
+	query.Set("api-version", "2018-02-01")
+	query.Set("resource", IMDSResource)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s?%s", endpoint, query.Encode()), nil)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Metadata", "true")
+
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("instance metadata service returned status: %s", resp.Status)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+
+	if token.AccessToken == "" {
+		return "", errors.New("instance metadata service did not return an access token")
+	}
+
+	return token.AccessToken, nil
+}
+
+// Helper function to exchange an Azure AD token for an ACR refresh token.
+func (p Provider) exchange(ctx context.Context, hostname, aad string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "access_token")
+	form.Set("service", hostname)
+	form.Set("access_token", aad)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("https://%s/oauth2/exchange", hostname), strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry returned status: %s", resp.Status)
+	}
+
+	var token struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+
+	if token.RefreshToken == "" {
+		return "", errors.New("registry did not return a refresh token")
+	}
+
+	return token.RefreshToken, nil
+}
@@ -0,0 +1,49 @@
+package acr
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpgrade(t *testing.T) {
+	imds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "true", r.Header.Get("Metadata"))
+		assert.Equal(t, IMDSResource, r.URL.Query().Get("resource"))
+		fmt.Fprint(w, `{"access_token": "aad"}`)
+	}))
+	defer imds.Close()
+
+	registry := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/oauth2/exchange", r.URL.Path)
+		assert.Equal(t, "access_token", r.FormValue("grant_type"))
+		assert.Equal(t, "aad", r.FormValue("access_token"))
+		fmt.Fprint(w, `{"refresh_token": "refresh"}`)
+	}))
+	defer registry.Close()
+
+	provider := Provider{
+		IMDSURL: imds.URL,
+		Client:  registry.Client(),
+	}
+
+	hostname := strings.TrimPrefix(registry.URL, "https://")
+
+	auth, err := provider.Upgrade(context.Background(), hostname+"/app", docker.AuthConfiguration{})
+	assert.NoError(t, err)
+	assert.Equal(t, docker.AuthConfiguration{Username: Username, Password: "refresh"}, auth)
+
+	auth, err = provider.Upgrade(context.Background(), hostname+"/app", docker.AuthConfiguration{Password: "aad"})
+	assert.NoError(t, err)
+	assert.Equal(t, docker.AuthConfiguration{Username: Username, Password: "refresh"}, auth)
+
+	auth, err = provider.Upgrade(context.Background(), hostname+"/app", docker.AuthConfiguration{Username: "sp", Password: "secret"})
+	assert.NoError(t, err)
+	assert.Equal(t, docker.AuthConfiguration{Username: "sp", Password: "secret"}, auth)
+}
@@ -0,0 +1,192 @@
+package buildkit
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// DefaultBinary used to run BuildKit builds.
+const DefaultBinary = "docker"
+
+// Secret mounted into a build using RUN --mount=type=secret,id=<id>.
+type Secret struct {
+	// ID referenced by the Dockerfile.
+	ID string
+	// Source file containing the secret.
+	Source string
+	// Env variable containing the secret.
+	Env string
+}
+
+// BuildOptions for a BuildKit build.
+type BuildOptions struct {
+	docker.BuildImageOptions
+	// Secrets mounted into the build.
+	Secrets []Secret
+	// SSH agent sockets or keys forwarded to the build eg. "default".
+	SSH []string
+}
+
+// Client builds images with BuildKit using the Docker CLI, because the Engine API
+// requires a BuildKit session to provide secrets and SSH agents.
+type Client struct {
+	// Binary of the Docker CLI. Defaults to DefaultBinary.
+	Binary string
+}
+
+// ParseSecret in the same format as the Docker CLI eg. "id=composer,src=auth.json" or "id=token,env=TOKEN".
+func ParseSecret(value string) (Secret, error) {
+	var secret Secret
+
+	for _, field := range strings.Split(value, ",") {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			return secret, fmt.Errorf("invalid secret field: %s", field)
+		}
+
+		switch parts[0] {
+		case "id":
+			secret.ID = parts[1]
+		case "src", "source":
+			secret.Source = parts[1]
+		case "env":
+			secret.Env = parts[1]
+		default:
+			return secret, fmt.Errorf("unsupported secret field: %s", parts[0])
+		}
+	}
+
+	if secret.ID == "" {
+		return secret, fmt.Errorf("secret does not have an id: %s", value)
+	}
+
+	if (secret.Source == "") == (secret.Env == "") {
+		return secret, fmt.Errorf("secret %q must have either a src or env", secret.ID)
+	}
+
+	return secret, nil
+}
+
+// String representation of the secret, as accepted by the Docker CLI.
+func (s Secret) String() string {
+	if s.Env != "" {
+		return fmt.Sprintf("id=%s,env=%s", s.ID, s.Env)
+	}
+
+	return fmt.Sprintf("id=%s,src=%s", s.ID, s.Source)
+}
+
+// Build an image. The image is loaded into the daemon so it can be tagged and pushed.
+func (c Client) Build(options BuildOptions) error {
+	binary := c.Binary
+	if binary == "" {
+		binary = DefaultBinary
+	}
+
+	var cmd *exec.Cmd
+
+	if options.Context != nil {
+		cmd = exec.CommandContext(options.Context, binary, Args(options)...)
+	} else {
+		cmd = exec.Command(binary, Args(options)...)
+	}
+
+	cmd.Stdout = options.OutputStream
+	cmd.Stderr = options.OutputStream
+
+	if cmd.Stdout == nil {
+		cmd.Stdout = io.Discard
+		cmd.Stderr = io.Discard
+	}
+
+	cmd.Env = append(os.Environ(), "DOCKER_BUILDKIT=1")
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("buildkit build failed: %w", err)
+	}
+
+	return nil
+}
+
+// Args for the Docker CLI to build an image.
+func Args(options BuildOptions) []string {
+	args := []string{"buildx", "build", "--load", "--progress", "plain"}
+
+	if options.Name != "" {
+		args = append(args, "--tag", options.Name)
+	}
+
+	// The Engine API resolves the Dockerfile relative to the context, whereas the CLI resolves it
+	// relative to the working directory.
+	if options.Dockerfile != "" {
+		dockerfile := options.Dockerfile
+		if !filepath.IsAbs(dockerfile) {
+			dockerfile = filepath.Join(options.ContextDir, dockerfile)
+		}
+
+		args = append(args, "--file", dockerfile)
+	}
+
+	if options.Target != "" {
+		args = append(args, "--target", options.Target)
+	}
+
+	if options.Platform != "" {
+		args = append(args, "--platform", options.Platform)
+	}
+
+	for _, key := range sortedKeys(options.Labels) {
+		args = append(args, "--label", fmt.Sprintf("%s=%s", key, options.Labels[key]))
+	}
+
+	for _, arg := range options.BuildArgs {
+		args = append(args, "--build-arg", fmt.Sprintf("%s=%s", arg.Name, arg.Value))
+	}
+
+	for _, image := range options.CacheFrom {
+		args = append(args, "--cache-from", image)
+	}
+
+	for _, secret := range options.Secrets {
+		args = append(args, "--secret", secret.String())
+	}
+
+	for _, ssh := range options.SSH {
+		args = append(args, "--ssh", ssh)
+	}
+
+	if options.NoCache {
+		args = append(args, "--no-cache")
+	}
+
+	if options.Pull {
+		args = append(args, "--pull")
+	}
+
+	contextDir := options.ContextDir
+	if contextDir == "" {
+		contextDir = "."
+	}
+
+	return append(args, contextDir)
+}
+
+// Helper function to return the keys of a map in a stable order.
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
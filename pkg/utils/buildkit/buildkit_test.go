@@ -0,0 +1,91 @@
+package buildkit
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSecret(t *testing.T) {
+	secret, err := ParseSecret("id=composer,src=auth.json")
+	assert.NoError(t, err)
+	assert.Equal(t, Secret{ID: "composer", Source: "auth.json"}, secret)
+	assert.Equal(t, "id=composer,src=auth.json", secret.String())
+
+	secret, err = ParseSecret("id=token,env=TOKEN")
+	assert.NoError(t, err)
+	assert.Equal(t, Secret{ID: "token", Env: "TOKEN"}, secret)
+	assert.Equal(t, "id=token,env=TOKEN", secret.String())
+
+	_, err = ParseSecret("src=auth.json")
+	assert.EqualError(t, err, "secret does not have an id: src=auth.json")
+
+	_, err = ParseSecret("id=token")
+	assert.EqualError(t, err, `secret "token" must have either a src or env`)
+
+	_, err = ParseSecret("id=token,type=file")
+	assert.EqualError(t, err, "unsupported secret field: type")
+}
+
+func TestArgs(t *testing.T) {
+	args := Args(BuildOptions{
+		BuildImageOptions: docker.BuildImageOptions{
+			Name:       "foo:222-compile",
+			Dockerfile: "compile/Dockerfile",
+			ContextDir: "bar",
+			Target:     "dev",
+			Platform:   "linux/arm64",
+			Labels:     map[string]string{"b": "2", "a": "1"},
+			BuildArgs:  []docker.BuildArg{{Name: "SKPR_VERSION", Value: "222"}},
+		},
+		Secrets: []Secret{{ID: "composer", Source: "auth.json"}},
+		SSH:     []string{"default"},
+	})
+
+	assert.Equal(t, []string{
+		"buildx", "build", "--load", "--progress", "plain",
+		"--tag", "foo:222-compile",
+		"--file", "bar/compile/Dockerfile",
+		"--target", "dev",
+		"--platform", "linux/arm64",
+		"--label", "a=1",
+		"--label", "b=2",
+		"--build-arg", "SKPR_VERSION=222",
+		"--secret", "id=composer,src=auth.json",
+		"--ssh", "default",
+		"bar",
+	}, args)
+}
+
+func TestBuild(t *testing.T) {
+	bin, err := filepath.Abs("testdata/bin")
+	assert.NoError(t, err)
+
+	var b bytes.Buffer
+
+	client := Client{
+		Binary: filepath.Join(bin, "docker"),
+	}
+
+	err = client.Build(BuildOptions{
+		BuildImageOptions: docker.BuildImageOptions{
+			Name:         "foo:222-compile",
+			ContextDir:   ".",
+			OutputStream: &b,
+		},
+		SSH: []string{"default"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "DOCKER_BUILDKIT=1 buildx build --load --progress plain --tag foo:222-compile --ssh default .\n", b.String())
+
+	err = client.Build(BuildOptions{
+		BuildImageOptions: docker.BuildImageOptions{
+			Name:         "broken",
+			OutputStream: &b,
+		},
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,228 @@
+package dockerconfig
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+const (
+	// EnvConfig overrides the directory which contains the Docker config file.
+	EnvConfig = "DOCKER_CONFIG"
+	// Filename of the Docker config file.
+	Filename = "config.json"
+
+	// IndexServer is the key used by Docker for Docker Hub credentials.
+	IndexServer = "https://index.docker.io/v1/"
+
+	// Username returned by credential helpers when the secret is an identity token.
+	tokenUsername = "<token>"
+)
+
+// Config is the subset of the Docker config file used for authentication.
+type Config struct {
+	Auths       map[string]AuthEntry `json:"auths"`
+	CredsStore  string               `json:"credsStore"`
+	CredHelpers map[string]string    `json:"credHelpers"`
+}
+
+// AuthEntry stored in the "auths" section of the Docker config file.
+type AuthEntry struct {
+	Auth          string `json:"auth"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	IdentityToken string `json:"identitytoken"`
+	RegistryToken string `json:"registrytoken"`
+}
+
+// helperResponse returned by a docker-credential-* helper.
+type helperResponse struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+// Path to the Docker config file.
+func Path() (string, error) {
+	if dir := os.Getenv(EnvConfig); dir != "" {
+		return filepath.Join(dir, Filename), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".docker", Filename), nil
+}
+
+// Load the Docker config file. A missing file results in an empty config.
+func Load(path string) (Config, error) {
+	var config Config
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return config, err
+	}
+
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+// Resolve credentials for a registry hostname. The source of the credentials is returned
+// eg. "credHelpers (ecr-login)". An empty source means no credentials were found.
+//
+// Sources are checked in the same order as the Docker CLI:
+// per-registry credHelpers, then the credsStore, then the auths entries.
+func (c Config) Resolve(ctx context.Context, hostname string) (docker.AuthConfiguration, string, error) {
+	hostname = normalize(hostname)
+
+	for key, helper := range c.CredHelpers {
+		if normalize(key) != hostname {
+			continue
+		}
+
+		auth, found, err := runHelper(ctx, helper, serverAddress(hostname))
+		if err != nil {
+			return auth, "", err
+		}
+
+		if found {
+			return auth, fmt.Sprintf("credHelpers (%s)", helper), nil
+		}
+	}
+
+	if c.CredsStore != "" {
+		auth, found, err := runHelper(ctx, c.CredsStore, serverAddress(hostname))
+		if err != nil {
+			return auth, "", err
+		}
+
+		if found {
+			return auth, fmt.Sprintf("credsStore (%s)", c.CredsStore), nil
+		}
+	}
+
+	for key, entry := range c.Auths {
+		if normalize(key) != hostname {
+			continue
+		}
+
+		auth, err := entry.authConfiguration(key)
+		if err != nil {
+			return auth, "", fmt.Errorf("failed to decode auths entry for %s: %w", key, err)
+		}
+
+		if auth.Username == "" && auth.Password == "" && auth.IdentityToken == "" && auth.RegistryToken == "" {
+			continue
+		}
+
+		return auth, "auths", nil
+	}
+
+	return docker.AuthConfiguration{}, "", nil
+}
+
+// Helper function to convert an auths entry.
+func (e AuthEntry) authConfiguration(serverAddress string) (docker.AuthConfiguration, error) {
+	auth := docker.AuthConfiguration{
+		Username:      e.Username,
+		Password:      e.Password,
+		ServerAddress: serverAddress,
+		IdentityToken: e.IdentityToken,
+		RegistryToken: e.RegistryToken,
+	}
+
+	if e.Auth != "" {
+		decoded, err := base64.StdEncoding.DecodeString(e.Auth)
+		if err != nil {
+			return auth, err
+		}
+
+		parts := strings.SplitN(string(decoded), ":", 2)
+		if len(parts) != 2 {
+			return auth, errors.New("auth contains invalid payload")
+		}
+
+		auth.Username = parts[0]
+		auth.Password = parts[1]
+	}
+
+	return auth, nil
+}
+
+// Helper function to get credentials from a docker-credential-* helper.
+func runHelper(ctx context.Context, helper, serverAddress string) (docker.AuthConfiguration, bool, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, fmt.Sprintf("docker-credential-%s", helper), "get")
+	cmd.Stdin = strings.NewReader(serverAddress)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		// Helpers report missing credentials on stdout and exit with an error.
+		if strings.Contains(stdout.String(), "credentials not found") {
+			return docker.AuthConfiguration{}, false, nil
+		}
+
+		return docker.AuthConfiguration{}, false, fmt.Errorf("credential helper %s failed: %w: %s", helper, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var resp helperResponse
+
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return docker.AuthConfiguration{}, false, fmt.Errorf("failed to parse credential helper %s response: %w", helper, err)
+	}
+
+	auth := docker.AuthConfiguration{
+		ServerAddress: serverAddress,
+	}
+
+	if resp.Username == tokenUsername {
+		auth.IdentityToken = resp.Secret
+	} else {
+		auth.Username = resp.Username
+		auth.Password = resp.Secret
+	}
+
+	return auth, resp.Secret != "", nil
+}
+
+// Helper function to normalize a registry address to a hostname.
+func normalize(address string) string {
+	address = strings.TrimPrefix(address, "https://")
+	address = strings.TrimPrefix(address, "http://")
+	address = strings.SplitN(address, "/", 2)[0]
+
+	switch address {
+	case "docker.io", "index.docker.io", "registry-1.docker.io":
+		return "docker.io"
+	}
+
+	return address
+}
+
+// Helper function to convert a hostname to the address expected by the Docker CLI.
+func serverAddress(hostname string) string {
+	if hostname == "docker.io" {
+		return IndexServer
+	}
+
+	return hostname
+}
@@ -0,0 +1,73 @@
+package dockerconfig
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolve(t *testing.T) {
+	bin, err := filepath.Abs("testdata/bin")
+	assert.NoError(t, err)
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	config, err := Load("testdata/config.json")
+	assert.NoError(t, err)
+
+	auth, source, err := config.Resolve(context.Background(), "123456789012.dkr.ecr.ap-southeast-2.amazonaws.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "credHelpers (test)", source)
+	assert.Equal(t, docker.AuthConfiguration{Username: "AWS", Password: "ecr", ServerAddress: "123456789012.dkr.ecr.ap-southeast-2.amazonaws.com"}, auth)
+
+	auth, source, err = config.Resolve(context.Background(), "store.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "credsStore (test)", source)
+	assert.Equal(t, docker.AuthConfiguration{IdentityToken: "identity", ServerAddress: "store.example.com"}, auth)
+
+	auth, source, err = config.Resolve(context.Background(), "harbor.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "auths", source)
+	assert.Equal(t, docker.AuthConfiguration{Username: "robot", Password: "secret", ServerAddress: "harbor.example.com"}, auth)
+
+	auth, source, err = config.Resolve(context.Background(), "docker.io")
+	assert.NoError(t, err)
+	assert.Equal(t, "auths", source)
+	assert.Equal(t, docker.AuthConfiguration{Username: "user", Password: "pass", ServerAddress: IndexServer}, auth)
+
+	_, source, err = config.Resolve(context.Background(), "missing.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "", source)
+}
+
+func TestResolveCancelled(t *testing.T) {
+	bin, err := filepath.Abs("testdata/bin")
+	assert.NoError(t, err)
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	config, err := Load("testdata/config.json")
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err = config.Resolve(ctx, "123456789012.dkr.ecr.ap-southeast-2.amazonaws.com")
+	assert.Error(t, err)
+}
+
+func TestLoadMissing(t *testing.T) {
+	config, err := Load("testdata/missing.json")
+	assert.NoError(t, err)
+	assert.Equal(t, Config{}, config)
+}
+
+func TestPath(t *testing.T) {
+	t.Setenv(EnvConfig, "/tmp/docker")
+
+	path, err := Path()
+	assert.NoError(t, err)
+	assert.Equal(t, "/tmp/docker/config.json", path)
+}
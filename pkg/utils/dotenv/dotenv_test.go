@@ -0,0 +1,38 @@
+package dotenv
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	vars, err := Load("testdata/args.env")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"COMPOSER_NO_DEV": "1",
+		"NODE_ENV":        "production",
+		"QUOTED":          "line one\nline two",
+		"LITERAL":         "$NOT_EXPANDED",
+		"EMPTY":           "",
+	}, vars)
+
+	_, err = Load("testdata/missing.env")
+	assert.Error(t, err)
+}
+
+func TestParse(t *testing.T) {
+	vars, err := Parse(strings.NewReader("A=1\nA=2\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"A": "2"}, vars)
+
+	_, err = Parse(strings.NewReader("# Comment\nINVALID\n"))
+	assert.EqualError(t, err, "line 2: expected KEY=VALUE")
+
+	_, err = Parse(strings.NewReader(`A="unterminated`))
+	assert.EqualError(t, err, `line 1: unterminated quote in "unterminated`)
+
+	_, err = Parse(strings.NewReader("MY KEY=1"))
+	assert.EqualError(t, err, `line 1: invalid key "MY KEY"`)
+}
@@ -0,0 +1,115 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"strings"
+)
+
+// Helper function to run a git command in a directory and return the trimmed output.
+func run(dir string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s failed: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// Revision of the commit checked out in a directory.
+func Revision(dir string) (string, error) {
+	return run(dir, "rev-parse", "HEAD")
+}
+
+// ShortRevision is an abbreviated Revision eg. for use as an image tag.
+func ShortRevision(dir string) (string, error) {
+	return run(dir, "rev-parse", "--short", "HEAD")
+}
+
+// Describe the commit checked out in a directory using the most recent tag eg. v1.2.0-3-gabc1234.
+// Falls back to the abbreviated commit SHA when there are no tags. Uncommitted changes
+// to tracked files are marked with a "-dirty" suffix when requested.
+func Describe(dir string, dirty bool) (string, error) {
+	args := []string{"describe", "--tags", "--always"}
+
+	if dirty {
+		args = append(args, "--dirty")
+	}
+
+	return run(dir, args...)
+}
+
+// Dirty determines if tracked files in a directory have uncommitted changes.
+func Dirty(dir string) (bool, error) {
+	status, err := run(dir, "status", "--porcelain", "--untracked-files=no")
+	if err != nil {
+		return false, err
+	}
+
+	return status != "", nil
+}
+
+// Info about the commit checked out in a directory.
+type Info struct {
+	// Revision is the full commit SHA.
+	Revision string
+	// ShortRevision is the abbreviated commit SHA.
+	ShortRevision string
+	// Branch which is checked out. Empty when the HEAD is detached.
+	Branch string
+	// Source URL of the origin remote, without credentials. Empty when there is no origin.
+	Source string
+}
+
+// Load information about the commit checked out in a directory.
+func Load(dir string) (Info, error) {
+	var (
+		info Info
+		err  error
+	)
+
+	info.Revision, err = Revision(dir)
+	if err != nil {
+		return info, err
+	}
+
+	info.ShortRevision, err = ShortRevision(dir)
+	if err != nil {
+		return info, err
+	}
+
+	branch, err := run(dir, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return info, err
+	}
+
+	if branch != "HEAD" {
+		info.Branch = branch
+	}
+
+	// Repositories without an origin eg. in a fresh clone are still valid.
+	if source, err := run(dir, "remote", "get-url", "origin"); err == nil {
+		info.Source = stripCredentials(source)
+	}
+
+	return info, nil
+}
+
+// Helper function to remove credentials from a remote URL eg. https://token@github.com/skpr/package.
+func stripCredentials(remote string) string {
+	u, err := url.Parse(remote)
+	if err != nil || u.User == nil || u.Scheme == "" {
+		return remote
+	}
+
+	u.User = nil
+
+	return u.String()
+}
@@ -0,0 +1,115 @@
+package gar
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+const (
+	// Username to pass to the Docker registry when authenticating with an access token.
+	// https://cloud.google.com/artifact-registry/docs/docker/authentication#token
+	Username = "oauth2accesstoken"
+	// UsernameJSONKey to pass to the Docker registry when authenticating with a service account key.
+	// https://cloud.google.com/artifact-registry/docs/docker/authentication#json-key
+	UsernameJSONKey = "_json_key"
+	// UsernameJSONKeyBase64 to pass to the Docker registry when authenticating with a base64 encoded service account key.
+	UsernameJSONKeyBase64 = "_json_key_base64"
+
+	// MetadataURL used to request an access token for the default service account.
+	MetadataURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+// Used for requests when a client has not been configured. Requests time out, so a metadata service
+// which cannot be reached eg. on a developer machine does not hang the build.
+var defaultClient = &http.Client{Timeout: 30 * time.Second}
+
+// Provider of Google Artifact Registry authentication.
+type Provider struct {
+	// MetadataURL overrides the metadata server endpoint.
+	MetadataURL string
+	// Client used for requests. Defaults to a client which times out after 30 seconds.
+	Client *http.Client
+}
+
+// Name implements the registry.Provider interface.
+func (p Provider) Name() string {
+	return "gar"
+}
+
+// Upgrade implements the registry.Provider interface.
+// Provided credentials eg. service account keys are passed through, a bare password is treated as an access token
+// and an access token is requested from the metadata server when no credentials are provided.
+func (p Provider) Upgrade(ctx context.Context, registry string, auth docker.AuthConfiguration) (docker.AuthConfiguration, error) {
+	if auth.Username != "" {
+		return auth, nil
+	}
+
+	if auth.Password != "" {
+		auth.Username = Username
+		return auth, nil
+	}
+
+	token, err := p.metadataToken(ctx)
+	if err != nil {
+		return auth, fmt.Errorf("failed to get access token from metadata server: %w", err)
+	}
+
+	auth.Username = Username
+	auth.Password = token
+
+	return auth, nil
+}
+
+// Helper function to return the configured client.
+func (p Provider) client() *http.Client {
+	if p.Client == nil {
+		return defaultClient
+	}
+
+	return p.Client
+}
+
+// Helper function to request an access token from the metadata server.
+func (p Provider) metadataToken(ctx context.Context) (string, error) {
+	endpoint := p.MetadataURL
+	if endpoint == "" {
+		endpoint = MetadataURL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("metadata server returned status: %s", resp.Status)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+
+	if token.AccessToken == "" {
+		return "", errors.New("metadata server did not return an access token")
+	}
+
+	return token.AccessToken, nil
+}
@@ -0,0 +1,49 @@
+package gar
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpgrade(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Google", r.Header.Get("Metadata-Flavor"))
+		fmt.Fprint(w, `{"access_token": "ya29.abc", "expires_in": 3599, "token_type": "Bearer"}`)
+	}))
+	defer server.Close()
+
+	provider := Provider{MetadataURL: server.URL}
+
+	auth, err := provider.Upgrade(context.Background(), "australia-southeast1-docker.pkg.dev/project/app", docker.AuthConfiguration{})
+	assert.NoError(t, err)
+	assert.Equal(t, docker.AuthConfiguration{Username: Username, Password: "ya29.abc"}, auth)
+
+	auth, err = provider.Upgrade(context.Background(), "australia-southeast1-docker.pkg.dev/project/app", docker.AuthConfiguration{Password: "ya29.def"})
+	assert.NoError(t, err)
+	assert.Equal(t, docker.AuthConfiguration{Username: Username, Password: "ya29.def"}, auth)
+
+	auth, err = provider.Upgrade(context.Background(), "australia-southeast1-docker.pkg.dev/project/app", docker.AuthConfiguration{Username: UsernameJSONKey, Password: "{}"})
+	assert.NoError(t, err)
+	assert.Equal(t, docker.AuthConfiguration{Username: UsernameJSONKey, Password: "{}"}, auth)
+}
+
+func TestUpgradeCancelled(t *testing.T) {
+	// A metadata server which never responds.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	_, err := Provider{MetadataURL: server.URL}.Upgrade(ctx, "australia-southeast1-docker.pkg.dev/project/app", docker.AuthConfiguration{})
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -2,8 +2,13 @@ package image
 
 import (
 	"fmt"
+	"regexp"
+	"strings"
 )
 
+// Docker tags are limited to 128 characters and must not start with a period or dash.
+var tagRegex = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
 // Name of the Docker image.
 func Name(registry, version, suffix string) string {
 	return fmt.Sprintf("%s:%s", registry, Tag(version, suffix))
@@ -13,3 +18,35 @@ func Name(registry, version, suffix string) string {
 func Tag(version, suffix string) string {
 	return fmt.Sprintf("%s-%s", version, suffix)
 }
+
+// PlatformTag assigned to a Docker image built for a platform eg. 1.0.0-linux-arm64.
+func PlatformTag(tag, platform string) string {
+	return fmt.Sprintf("%s-%s", tag, strings.ReplaceAll(platform, "/", "-"))
+}
+
+// Pinned reference to a Docker image by digest.
+func Pinned(repository, digest string) string {
+	return fmt.Sprintf("%s@%s", repository, digest)
+}
+
+// Characters which are not allowed in a Docker tag.
+var invalidTagChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// SanitizeTag converts a value into a valid Docker tag eg. "feature/foo" results in "feature-foo".
+func SanitizeTag(value string) string {
+	tag := invalidTagChars.ReplaceAllString(value, "-")
+
+	// Tags must start with an alphanumeric character or underscore.
+	tag = strings.TrimLeft(tag, ".-")
+
+	if len(tag) > 128 {
+		tag = tag[:128]
+	}
+
+	return tag
+}
+
+// ValidTag determines if a tag is valid for a Docker image.
+func ValidTag(tag string) bool {
+	return tagRegex.MatchString(tag)
+}
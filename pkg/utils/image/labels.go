@@ -0,0 +1,37 @@
+package image
+
+import (
+	"time"
+)
+
+// Standard labels which describe an image.
+// https://github.com/opencontainers/image-spec/blob/main/annotations.md
+const (
+	// LabelCreated is the date and time the image was built, in RFC 3339 format.
+	LabelCreated = "org.opencontainers.image.created"
+	// LabelVersion of the packaged application.
+	LabelVersion = "org.opencontainers.image.version"
+	// LabelRevision of the source the image was built from eg. a git commit SHA.
+	LabelRevision = "org.opencontainers.image.revision"
+	// LabelSource URL of the source the image was built from.
+	LabelSource = "org.opencontainers.image.source"
+)
+
+// Labels describing where an image came from. Empty values are omitted.
+func Labels(version, revision, source string, created time.Time) map[string]string {
+	labels := map[string]string{
+		LabelCreated: created.UTC().Format(time.RFC3339),
+	}
+
+	for key, value := range map[string]string{
+		LabelVersion:  version,
+		LabelRevision: revision,
+		LabelSource:   source,
+	} {
+		if value != "" {
+			labels[key] = value
+		}
+	}
+
+	return labels
+}
@@ -0,0 +1,24 @@
+package image
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLabels(t *testing.T) {
+	created := time.Date(2022, 7, 1, 10, 30, 0, 0, time.FixedZone("AEST", 10*60*60))
+
+	assert.Equal(t, map[string]string{
+		LabelCreated:  "2022-07-01T00:30:00Z",
+		LabelVersion:  "1.0.0",
+		LabelRevision: "0123456789abcdef",
+		LabelSource:   "https://github.com/skpr/package",
+	}, Labels("1.0.0", "0123456789abcdef", "https://github.com/skpr/package", created))
+
+	assert.Equal(t, map[string]string{
+		LabelCreated: "2022-07-01T00:30:00Z",
+		LabelVersion: "1.0.0",
+	}, Labels("1.0.0", "", "", created))
+}
@@ -0,0 +1,137 @@
+package image
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/skpr/package/pkg/utils/git"
+)
+
+const (
+	// DefaultRepositoryTemplate pushes every image to the registry repository.
+	DefaultRepositoryTemplate = "{{ .Registry }}"
+	// DefaultTagTemplate distinguishes images by suffixing the tag with the image name.
+	DefaultTagTemplate = "{{ .Version }}-{{ .Image }}"
+
+	// PerImageRepositoryTemplate pushes each image to its own repository eg. registry/web.
+	PerImageRepositoryTemplate = "{{ .Registry }}/{{ .Image }}"
+	// PerImageTagTemplate tags each image with the version only.
+	PerImageTagTemplate = "{{ .Version }}"
+)
+
+const (
+	// PresetDefault uses a single repository eg. registry:version-web.
+	PresetDefault = "default"
+	// PresetPerImage uses a repository per image eg. registry/web:version.
+	PresetPerImage = "per-image"
+)
+
+// Data available to naming templates.
+type Data struct {
+	// Registry the images are pushed to.
+	Registry string
+	// Image name eg. web.
+	Image string
+	// Version being packaged.
+	Version string
+	// Git information about the context.
+	Git git.Info
+}
+
+// Naming of images using templates.
+type Naming struct {
+	repository *template.Template
+	tag        *template.Template
+}
+
+// NewNaming from a preset, which individual templates may override.
+func NewNaming(preset, repository, tag string) (Naming, error) {
+	var naming Naming
+
+	switch preset {
+	case "", PresetDefault:
+		if repository == "" {
+			repository = DefaultRepositoryTemplate
+		}
+		if tag == "" {
+			tag = DefaultTagTemplate
+		}
+	case PresetPerImage:
+		if repository == "" {
+			repository = PerImageRepositoryTemplate
+		}
+		if tag == "" {
+			tag = PerImageTagTemplate
+		}
+	default:
+		return naming, fmt.Errorf("naming preset not found: %s", preset)
+	}
+
+	var err error
+
+	naming.repository, err = template.New("repository").Option("missingkey=error").Parse(repository)
+	if err != nil {
+		return naming, fmt.Errorf("failed to parse repository template: %w", err)
+	}
+
+	naming.tag, err = template.New("tag").Option("missingkey=error").Parse(tag)
+	if err != nil {
+		return naming, fmt.Errorf("failed to parse tag template: %w", err)
+	}
+
+	return naming, nil
+}
+
+// Repository for an image.
+func (n Naming) Repository(data Data) (string, error) {
+	if n.repository == nil {
+		return data.Registry, nil
+	}
+
+	return execute(n.repository, data)
+}
+
+// Tag for an image.
+func (n Naming) Tag(data Data) (string, error) {
+	if n.tag == nil {
+		return Tag(data.Version, data.Image), nil
+	}
+
+	tag, err := execute(n.tag, data)
+	if err != nil {
+		return "", err
+	}
+
+	if !ValidTag(tag) {
+		return "", fmt.Errorf("invalid tag: %s", tag)
+	}
+
+	return tag, nil
+}
+
+// Name of an image eg. repository:tag.
+func (n Naming) Name(data Data) (string, error) {
+	repository, err := n.Repository(data)
+	if err != nil {
+		return "", err
+	}
+
+	tag, err := n.Tag(data)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s:%s", repository, tag), nil
+}
+
+// Helper function to execute a template.
+func execute(t *template.Template, data Data) (string, error) {
+	var b strings.Builder
+
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,77 @@
+package image
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skpr/package/pkg/utils/git"
+)
+
+func TestNaming(t *testing.T) {
+	data := Data{
+		Registry: "example.com/project",
+		Image:    "web",
+		Version:  "1.4.0",
+		Git: git.Info{
+			ShortRevision: "abc1234",
+			Branch:        "main",
+		},
+	}
+
+	var zero Naming
+
+	name, err := zero.Name(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com/project:1.4.0-web", name)
+
+	naming, err := NewNaming(PresetDefault, "", "")
+	assert.NoError(t, err)
+
+	name, err = naming.Name(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com/project:1.4.0-web", name)
+
+	naming, err = NewNaming(PresetPerImage, "", "")
+	assert.NoError(t, err)
+
+	name, err = naming.Name(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com/project/web:1.4.0", name)
+
+	naming, err = NewNaming(PresetPerImage, "", "{{ .Version }}-{{ .Git.ShortRevision }}")
+	assert.NoError(t, err)
+
+	name, err = naming.Name(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com/project/web:1.4.0-abc1234", name)
+
+	naming, err = NewNaming(PresetDefault, "", "{{ .Git.Branch }}/{{ .Image }}")
+	assert.NoError(t, err)
+
+	_, err = naming.Name(data)
+	assert.EqualError(t, err, "invalid tag: main/web")
+
+	_, err = NewNaming("nope", "", "")
+	assert.Error(t, err)
+
+	_, err = NewNaming(PresetDefault, "{{ .Registry", "")
+	assert.Error(t, err)
+}
+
+func TestValidTag(t *testing.T) {
+	assert.True(t, ValidTag("1.4.0-web"))
+	assert.True(t, ValidTag("latest"))
+	assert.False(t, ValidTag("-web"))
+	assert.False(t, ValidTag("feature/web"))
+	assert.False(t, ValidTag(""))
+}
+
+func TestSanitizeTag(t *testing.T) {
+	assert.Equal(t, "v1.2.0-3-gabc1234-dirty", SanitizeTag("v1.2.0-3-gabc1234-dirty"))
+	assert.Equal(t, "feature-foo", SanitizeTag("feature/foo"))
+	assert.Equal(t, "foo", SanitizeTag(".-foo"))
+	assert.Len(t, SanitizeTag(strings.Repeat("a", 200)), 128)
+	assert.True(t, ValidTag(SanitizeTag("release/1.0 (rc1)")))
+}
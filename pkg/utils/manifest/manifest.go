@@ -0,0 +1,193 @@
+package manifest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/skpr/package/pkg/utils/dotenv"
+	"github.com/skpr/package/pkg/utils/finder"
+)
+
+// Filename of the optional manifest stored in the package directory.
+const Filename = "package.yml"
+
+// ArgsFilename of the optional build args stored in the directory of each image eg. compile/args.env.
+const ArgsFilename = "args.env"
+
+// Manifest declares the images which make up a package.
+type Manifest struct {
+	Naming Naming `yaml:"naming"`
+	// Labels applied to every image.
+	Labels map[string]string `yaml:"labels"`
+	Images map[string]Image  `yaml:"images"`
+}
+
+// Naming declares how images are named. See image.NewNaming.
+type Naming struct {
+	// Preset eg. "per-image".
+	Preset string `yaml:"preset"`
+	// Repository template eg. "{{ .Registry }}/{{ .Image }}".
+	Repository string `yaml:"repository"`
+	// Tag template eg. "{{ .Version }}".
+	Tag string `yaml:"tag"`
+}
+
+// Image declares how a single image is built.
+type Image struct {
+	// Dockerfile path, relative to the context directory once loaded.
+	Dockerfile string `yaml:"dockerfile"`
+	// Context directory for the build, relative to the default context eg. the root of the repository.
+	// Empty means the default context is used.
+	Context string `yaml:"context"`
+	// Target stage of a multi-stage Dockerfile.
+	Target string `yaml:"target"`
+	// BuildArgs passed to this image only. Args declared in the manifest take precedence
+	// over args loaded from the ArgsFilename in the directory of the image.
+	BuildArgs map[string]string `yaml:"args"`
+	// Labels applied to the image.
+	Labels map[string]string `yaml:"labels"`
+	// Push the image to the registry. Nil means the builder decides.
+	Push *bool `yaml:"push"`
+	// Depends on other images which must be built first.
+	Depends []string `yaml:"depends"`
+	// Tags are additional versions the image is tagged with. Tags are evaluated using the tag template
+	// in place of the version eg. "latest" results in "latest-<image>" with the default naming preset.
+	Tags []string `yaml:"tags"`
+	// Secrets mounted into the build by ID eg. "composer". Secrets which are not listed are not mounted.
+	// Requires BuildKit.
+	Secrets []string `yaml:"secrets"`
+	// SSH agent sockets or keys forwarded to the build eg. "default". Requires BuildKit.
+	SSH []string `yaml:"ssh"`
+}
+
+// Load the manifest from the package directory, falling back to a directory scan
+// when no manifest file exists. Contexts are resolved relative to the default context.
+func Load(dir, context string) (Manifest, bool, error) {
+	path := filepath.Join(dir, Filename)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		dockerfiles, err := finder.FindDockerfiles(dir)
+		if err != nil {
+			return Manifest{}, false, fmt.Errorf("failed to find dockerfiles: %w", err)
+		}
+
+		m := FromDockerfiles(dockerfiles)
+
+		return m, false, loadArgs(dir, m)
+	}
+	if err != nil {
+		return Manifest{}, false, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	m, err := Parse(dir, context, data)
+	if err != nil {
+		return m, true, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	return m, true, loadArgs(dir, m)
+}
+
+// Helper function to load the build args stored in the directory of each image.
+func loadArgs(dir string, m Manifest) error {
+	for name, img := range m.Images {
+		args, err := dotenv.Load(filepath.Join(dir, name, ArgsFilename))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load args for image %q: %w", name, err)
+		}
+
+		for key, value := range img.BuildArgs {
+			args[key] = value
+		}
+
+		img.BuildArgs = args
+		m.Images[name] = img
+	}
+
+	return nil
+}
+
+// Parse manifest data. Dockerfiles are resolved relative to the package directory and contexts
+// relative to the default context, so images which declare a context share the same base as those which do not.
+func Parse(dir, context string, data []byte) (Manifest, error) {
+	var m Manifest
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	// An empty manifest is reported as declaring no images.
+	if err := decoder.Decode(&m); err != nil && !errors.Is(err, io.EOF) {
+		return m, err
+	}
+
+	if len(m.Images) == 0 {
+		return m, errors.New("no images declared")
+	}
+
+	for name, img := range m.Images {
+		if img.Dockerfile == "" {
+			img.Dockerfile = filepath.Join(name, "Dockerfile")
+		}
+
+		img.Dockerfile = filepath.Join(dir, img.Dockerfile)
+
+		if img.Context != "" {
+			img.Context = filepath.Join(context, img.Context)
+
+			// Docker expects the Dockerfile to be addressed from within the context.
+			rel, err := filepath.Rel(img.Context, img.Dockerfile)
+			if err != nil {
+				return m, fmt.Errorf("image %q: %w", name, err)
+			}
+
+			if strings.HasPrefix(rel, "..") {
+				return m, fmt.Errorf("image %q: dockerfile %q is outside of context %q", name, img.Dockerfile, img.Context)
+			}
+
+			img.Dockerfile = rel
+		}
+
+		m.Images[name] = img
+	}
+
+	return m, nil
+}
+
+// FromDockerfiles converts the result of a directory scan into a manifest.
+func FromDockerfiles(dockerfiles finder.Dockerfiles) Manifest {
+	m := Manifest{
+		Images: make(map[string]Image, len(dockerfiles)),
+	}
+
+	for name, path := range dockerfiles {
+		m.Images[name] = Image{
+			Dockerfile: path,
+		}
+	}
+
+	return m
+}
+
+// Names of the images in the manifest, sorted.
+func (m Manifest) Names() []string {
+	var names []string
+
+	for name := range m.Images {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
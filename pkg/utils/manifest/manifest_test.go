@@ -0,0 +1,82 @@
+package manifest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	m, declared, err := Load("testdata/manifest", "testdata/manifest")
+	assert.NoError(t, err)
+	assert.True(t, declared)
+
+	assert.Equal(t, []string{"app", "compile", "debug"}, m.Names())
+
+	assert.Equal(t, "testdata/manifest/compile/Dockerfile", m.Images["compile"].Dockerfile)
+	assert.Equal(t, "build", m.Images["compile"].Target)
+	assert.Equal(t, map[string]string{"COMPOSER_NO_DEV": "1"}, m.Images["compile"].BuildArgs)
+
+	assert.Equal(t, "Dockerfile", m.Images["app"].Dockerfile)
+	assert.Equal(t, "testdata/manifest/app", m.Images["app"].Context)
+	assert.Equal(t, map[string]string{"team": "platform"}, m.Images["app"].Labels)
+	assert.Nil(t, m.Images["app"].Push)
+
+	assert.Equal(t, "testdata/manifest/app/Dockerfile", m.Images["debug"].Dockerfile)
+	assert.Equal(t, "debug", m.Images["debug"].Target)
+	assert.False(t, *m.Images["debug"].Push)
+}
+
+func TestLoadFallback(t *testing.T) {
+	m, declared, err := Load("testdata/scan", "testdata/scan")
+	assert.NoError(t, err)
+	assert.False(t, declared)
+
+	assert.Equal(t, []string{"app", "compile"}, m.Names())
+	assert.Equal(t, "testdata/scan/app/Dockerfile", m.Images["app"].Dockerfile)
+	assert.Equal(t, "testdata/scan/compile/Dockerfile", m.Images["compile"].Dockerfile)
+}
+
+func TestLoadArgs(t *testing.T) {
+	m, _, err := Load("testdata/args", "testdata/args")
+	assert.NoError(t, err)
+
+	// Args declared in the manifest take precedence over the args file.
+	assert.Equal(t, map[string]string{"COMPOSER_NO_DEV": "1", "PHP_VERSION": "8.1"}, m.Images["compile"].BuildArgs)
+	assert.Nil(t, m.Images["app"].BuildArgs)
+}
+
+func TestParseContext(t *testing.T) {
+	// Contexts share the same base as the default context, rather than the package directory.
+	m, err := Parse(".skpr/package", ".", []byte(`
+images:
+  app:
+    dockerfile: app/Dockerfile
+    context: .
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, ".", m.Images["app"].Context)
+	assert.Equal(t, ".skpr/package/app/Dockerfile", m.Images["app"].Dockerfile)
+}
+
+func TestParseDockerfileOutsideContext(t *testing.T) {
+	_, err := Parse(".skpr/package", ".", []byte(`
+images:
+  app:
+    dockerfile: app/Dockerfile
+    context: cli
+`))
+	assert.Error(t, err)
+}
+
+func TestParseUnknownField(t *testing.T) {
+	_, err := Parse(".skpr/package", ".", []byte(`
+images:
+  app:
+    dockerfle: app/Dockerfile
+`))
+	assert.ErrorContains(t, err, "field dockerfle not found")
+
+	_, err = Parse(".skpr/package", ".", []byte(``))
+	assert.EqualError(t, err, "no images declared")
+}
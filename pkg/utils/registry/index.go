@@ -0,0 +1,393 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+const (
+	// MediaTypeImageIndex is the OCI image index media type.
+	MediaTypeImageIndex = "application/vnd.oci.image.index.v1+json"
+	// MediaTypeImageManifest is the OCI image manifest media type.
+	MediaTypeImageManifest = "application/vnd.oci.image.manifest.v1+json"
+	// MediaTypeDockerManifest is the Docker image manifest media type, which the daemon pushes by default.
+	MediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+)
+
+// Used for requests when a client has not been configured, so a registry which stops responding
+// does not hang the build.
+var defaultClient = &http.Client{Timeout: 30 * time.Second}
+
+// Docker Hub is addressed using a different hostname to its image references.
+const dockerHubHostname = "registry-1.docker.io"
+
+// IndexManifest references an image which has already been pushed for a platform.
+type IndexManifest struct {
+	// Tag of the image in the repository eg. 1.0.0-linux-arm64.
+	Tag string
+	// Platform of the image eg. linux/arm64.
+	Platform string
+}
+
+// Platform of an image in an OCI image index.
+type Platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// Descriptor of a manifest in an OCI image index.
+type Descriptor struct {
+	MediaType string    `json:"mediaType"`
+	Digest    string    `json:"digest"`
+	Size      int64     `json:"size"`
+	Platform  *Platform `json:"platform,omitempty"`
+}
+
+// Index is an OCI image index, also known as a manifest list.
+type Index struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	Manifests     []Descriptor `json:"manifests"`
+}
+
+// IndexClient pushes image indexes, which the Docker Engine API does not support.
+// https://github.com/opencontainers/distribution-spec/blob/main/spec.md
+type IndexClient struct {
+	// Client used for requests. Defaults to a client which times out after 30 seconds.
+	Client *http.Client
+}
+
+// ParsePlatform eg. "linux/arm64/v8".
+func ParsePlatform(platform string) (Platform, error) {
+	parts := strings.Split(platform, "/")
+
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return Platform{}, fmt.Errorf("invalid platform: %s", platform)
+	}
+
+	p := Platform{
+		OS:           parts[0],
+		Architecture: parts[1],
+	}
+
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+
+	return p, nil
+}
+
+// PushIndex for a repository eg. "example.com/app" which references images already pushed for each platform.
+// Returns the digest of the index.
+func (c IndexClient) PushIndex(ctx context.Context, repository, tag string, manifests []IndexManifest, auth docker.AuthConfiguration) (string, error) {
+	index := Index{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeImageIndex,
+	}
+
+	session := &session{
+		client:     c.Client,
+		repository: repository,
+		auth:       auth,
+	}
+
+	if session.client == nil {
+		session.client = defaultClient
+	}
+
+	for _, manifest := range manifests {
+		platform, err := ParsePlatform(manifest.Platform)
+		if err != nil {
+			return "", err
+		}
+
+		descriptor, err := session.head(ctx, manifest.Tag)
+		if err != nil {
+			return "", fmt.Errorf("failed to query manifest %s:%s: %w", repository, manifest.Tag, err)
+		}
+
+		descriptor.Platform = &platform
+
+		index.Manifests = append(index.Manifests, descriptor)
+	}
+
+	body, err := json.Marshal(index)
+	if err != nil {
+		return "", err
+	}
+
+	digest, err := session.put(ctx, tag, MediaTypeImageIndex, body)
+	if err != nil {
+		return "", fmt.Errorf("failed to push index %s:%s: %w", repository, tag, err)
+	}
+
+	return digest, nil
+}
+
+// StatusError is returned when the registry responds with an unexpected status.
+type StatusError struct {
+	// StatusCode of the response eg. 503.
+	StatusCode int
+	// Status of the response eg. "503 Service Unavailable".
+	Status string
+	// Message in the body of the response, if any.
+	Message string
+	// RetryAfter is how long the registry asked clients to wait before retrying. Zero if not provided.
+	RetryAfter time.Duration
+}
+
+// Error implements the error interface.
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("registry returned status: %s", e.Status)
+	}
+
+	return fmt.Sprintf("registry returned status: %s: %s", e.Status, e.Message)
+}
+
+// Helper function to build a StatusError from a response.
+func newStatusError(resp *http.Response) *StatusError {
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	return &StatusError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Message:    strings.TrimSpace(string(message)),
+		RetryAfter: ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// ParseRetryAfter header, which is either a number of seconds or a date. Returns zero if it is invalid.
+func ParseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+
+	return 0
+}
+
+// session with a registry for a single repository, which authorizes requests when challenged.
+type session struct {
+	client     *http.Client
+	repository string
+	auth       docker.AuthConfiguration
+	// Authorization header used once the registry has challenged a request.
+	authorization string
+}
+
+// Helper function to query the descriptor of a manifest.
+func (s *session) head(ctx context.Context, reference string) (Descriptor, error) {
+	var descriptor Descriptor
+
+	resp, err := s.do(ctx, http.MethodHead, reference, func(req *http.Request) {
+		req.Header.Set("Accept", strings.Join([]string{MediaTypeImageManifest, MediaTypeDockerManifest}, ", "))
+	}, nil)
+	if err != nil {
+		return descriptor, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return descriptor, newStatusError(resp)
+	}
+
+	descriptor.MediaType = resp.Header.Get("Content-Type")
+	descriptor.Digest = resp.Header.Get("Docker-Content-Digest")
+
+	descriptor.Size, err = strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return descriptor, fmt.Errorf("registry returned an invalid content length: %w", err)
+	}
+
+	if descriptor.Digest == "" {
+		return descriptor, errors.New("registry did not return a digest")
+	}
+
+	return descriptor, nil
+}
+
+// Helper function to upload a manifest, returning the digest.
+func (s *session) put(ctx context.Context, reference, mediaType string, body []byte) (string, error) {
+	resp, err := s.do(ctx, http.MethodPut, reference, func(req *http.Request) {
+		req.Header.Set("Content-Type", mediaType)
+	}, body)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return "", newStatusError(resp)
+	}
+
+	return resp.Header.Get("Docker-Content-Digest"), nil
+}
+
+// Helper function to send a manifest request, authorizing and retrying once if challenged.
+func (s *session) do(ctx context.Context, method, reference string, prepare func(*http.Request), body []byte) (*http.Response, error) {
+	hostname, repository := splitRepository(s.repository)
+
+	scheme := "https"
+	if strings.HasPrefix(hostname, "localhost") || strings.HasPrefix(hostname, "127.0.0.1") {
+		scheme = "http"
+	}
+
+	endpoint := fmt.Sprintf("%s://%s/v2/%s/manifests/%s", scheme, hostname, repository, reference)
+
+	send := func() (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+
+		prepare(req)
+
+		if s.authorization != "" {
+			req.Header.Set("Authorization", s.authorization)
+		}
+
+		return s.client.Do(req)
+	}
+
+	resp, err := send()
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusUnauthorized || s.authorization != "" {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	s.authorization, err = s.authorize(ctx, resp.Header.Get("WWW-Authenticate"), repository)
+	if err != nil {
+		return nil, err
+	}
+
+	return send()
+}
+
+// Helper function to respond to an authentication challenge with the credentials of the session.
+func (s *session) authorize(ctx context.Context, header, repository string) (string, error) {
+	scheme, challenge := parseChallenge(header)
+
+	if strings.EqualFold(scheme, "basic") {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(s.auth.Username+":"+s.auth.Password)), nil
+	}
+
+	if !strings.EqualFold(scheme, "bearer") {
+		return "", fmt.Errorf("unsupported authentication scheme: %s", scheme)
+	}
+
+	// A token issued for the registry can be used directly.
+	if s.auth.RegistryToken != "" {
+		return "Bearer " + s.auth.RegistryToken, nil
+	}
+
+	realm, ok := challenge["realm"]
+	if !ok {
+		return "", errors.New("authentication challenge did not contain a realm")
+	}
+
+	query := url.Values{}
+	query.Set("client_id", ClientID)
+	query.Set("scope", fmt.Sprintf("repository:%s:pull,push", repository))
+
+	if service, ok := challenge["service"]; ok {
+		query.Set("service", service)
+	}
+
+	var (
+		req *http.Request
+		err error
+	)
+
+	// Refresh tokens are exchanged using the OAuth2 flow.
+	if s.auth.IdentityToken != "" {
+		query.Set("grant_type", "refresh_token")
+		query.Set("refresh_token", s.auth.IdentityToken)
+
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, realm, strings.NewReader(query.Encode()))
+		if err != nil {
+			return "", err
+		}
+
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s?%s", realm, query.Encode()), nil)
+		if err != nil {
+			return "", err
+		}
+
+		if s.auth.Username != "" {
+			req.SetBasicAuth(s.auth.Username, s.auth.Password)
+		}
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to request token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token service returned status: %s", resp.Status)
+	}
+
+	var token tokenResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode token: %w", err)
+	}
+
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+
+	if token.Token == "" {
+		return "", errors.New("token service did not return a token")
+	}
+
+	return "Bearer " + token.Token, nil
+}
+
+// Helper function to split a repository into the registry hostname and repository path,
+// applying the same defaults as Docker eg. "app" is "registry-1.docker.io" and "library/app".
+func splitRepository(repository string) (string, string) {
+	hostname, path := Hostname(repository), Repository(repository)
+
+	if hostname != DockerHub {
+		return hostname, path
+	}
+
+	if !strings.Contains(path, "/") {
+		path = "library/" + path
+	}
+
+	return dockerHubHostname, path
+}
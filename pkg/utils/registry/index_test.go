@@ -0,0 +1,151 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPushIndex(t *testing.T) {
+	var (
+		server *httptest.Server
+		index  Index
+	)
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			username, password, _ := r.BasicAuth()
+			assert.Equal(t, "robot", username)
+			assert.Equal(t, "secret", password)
+			assert.Equal(t, "repository:project/app:pull,push", r.URL.Query().Get("scope"))
+			fmt.Fprint(w, `{"token": "abc123"}`)
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer abc123" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodHead && r.URL.Path == "/v2/project/app/manifests/1.0.0-linux-amd64":
+			w.Header().Set("Content-Type", MediaTypeDockerManifest)
+			w.Header().Set("Docker-Content-Digest", "sha256:amd64")
+			w.Header().Set("Content-Length", "1024")
+		case r.Method == http.MethodHead && r.URL.Path == "/v2/project/app/manifests/1.0.0-linux-arm64-v8":
+			w.Header().Set("Content-Type", MediaTypeDockerManifest)
+			w.Header().Set("Docker-Content-Digest", "sha256:arm64")
+			w.Header().Set("Content-Length", "2048")
+		case r.Method == http.MethodPut && r.URL.Path == "/v2/project/app/manifests/1.0.0":
+			assert.Equal(t, MediaTypeImageIndex, r.Header.Get("Content-Type"))
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&index))
+			w.Header().Set("Docker-Content-Digest", "sha256:index")
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	repository := fmt.Sprintf("%s/project/app", strings.TrimPrefix(server.URL, "http://"))
+
+	digest, err := IndexClient{Client: server.Client()}.PushIndex(context.Background(), repository, "1.0.0", []IndexManifest{
+		{Tag: "1.0.0-linux-amd64", Platform: "linux/amd64"},
+		{Tag: "1.0.0-linux-arm64-v8", Platform: "linux/arm64/v8"},
+	}, docker.AuthConfiguration{
+		Username: "robot",
+		Password: "secret",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256:index", digest)
+
+	assert.Equal(t, Index{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeImageIndex,
+		Manifests: []Descriptor{
+			{
+				MediaType: MediaTypeDockerManifest,
+				Digest:    "sha256:amd64",
+				Size:      1024,
+				Platform:  &Platform{OS: "linux", Architecture: "amd64"},
+			},
+			{
+				MediaType: MediaTypeDockerManifest,
+				Digest:    "sha256:arm64",
+				Size:      2048,
+				Platform:  &Platform{OS: "linux", Architecture: "arm64", Variant: "v8"},
+			},
+		},
+	}, index)
+
+	_, err = IndexClient{Client: server.Client()}.PushIndex(context.Background(), repository, "1.0.0", []IndexManifest{
+		{Tag: "missing", Platform: "linux/amd64"},
+	}, docker.AuthConfiguration{
+		Username: "robot",
+		Password: "secret",
+	})
+	assert.Error(t, err)
+}
+
+func TestPushIndexStatusError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, "slow down")
+	}))
+	defer server.Close()
+
+	repository := fmt.Sprintf("%s/project/app", strings.TrimPrefix(server.URL, "http://"))
+
+	_, err := IndexClient{Client: server.Client()}.PushIndex(context.Background(), repository, "1.0.0", nil, docker.AuthConfiguration{})
+
+	var status *StatusError
+	assert.ErrorAs(t, err, &status)
+	assert.Equal(t, http.StatusTooManyRequests, status.StatusCode)
+	assert.Equal(t, "slow down", status.Message)
+	assert.Equal(t, 30*time.Second, status.RetryAfter)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 120*time.Second, ParseRetryAfter("120", now))
+	assert.Equal(t, time.Minute, ParseRetryAfter("Mon, 01 Jan 2024 00:01:00 GMT", now))
+	assert.Equal(t, time.Duration(0), ParseRetryAfter("Sun, 31 Dec 2023 23:59:00 GMT", now))
+	assert.Equal(t, time.Duration(0), ParseRetryAfter("-1", now))
+	assert.Equal(t, time.Duration(0), ParseRetryAfter("soon", now))
+	assert.Equal(t, time.Duration(0), ParseRetryAfter("", now))
+}
+
+func TestParsePlatform(t *testing.T) {
+	platform, err := ParsePlatform("linux/arm/v7")
+	assert.NoError(t, err)
+	assert.Equal(t, Platform{OS: "linux", Architecture: "arm", Variant: "v7"}, platform)
+
+	_, err = ParsePlatform("arm64")
+	assert.Error(t, err)
+}
+
+func TestSplitRepository(t *testing.T) {
+	for repository, expected := range map[string][2]string{
+		"example.com/project/app": {"example.com", "project/app"},
+		"localhost/app":           {"localhost", "app"},
+		"localhost:5000/app":      {"localhost:5000", "app"},
+		"skpr/app":                {dockerHubHostname, "skpr/app"},
+		"app":                     {dockerHubHostname, "library/app"},
+		"docker.io/skpr/app":      {dockerHubHostname, "skpr/app"},
+		"docker.io/app":           {dockerHubHostname, "library/app"},
+	} {
+		hostname, path := splitRepository(repository)
+		assert.Equal(t, expected, [2]string{hostname, path}, repository)
+	}
+}
@@ -0,0 +1,179 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// ClientID sent to token services which issue refresh tokens.
+const ClientID = "skpr-package"
+
+// OAuth2 exchanges credentials for a token using the Docker registry token authentication flow.
+// https://docs.docker.com/registry/spec/auth/token/
+type OAuth2 struct {
+	// Client used for requests. Defaults to a client which times out after 30 seconds.
+	Client *http.Client
+}
+
+// tokenResponse returned by a registry token service.
+type tokenResponse struct {
+	Token        string `json:"token"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Name implements the Provider interface.
+func (p OAuth2) Name() string {
+	return "oauth2"
+}
+
+// ExchangesLogin implements the Exchanger interface.
+func (p OAuth2) ExchangesLogin() bool {
+	return true
+}
+
+// Upgrade implements the Provider interface.
+func (p OAuth2) Upgrade(ctx context.Context, registry string, auth docker.AuthConfiguration) (docker.AuthConfiguration, error) {
+	client := p.Client
+	if client == nil {
+		client = defaultClient
+	}
+
+	hostname, repository := splitRepository(registry)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("https://%s/v2/", hostname), nil)
+	if err != nil {
+		return auth, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return auth, fmt.Errorf("failed to query registry: %w", err)
+	}
+	resp.Body.Close()
+
+	// The registry does not require token authentication.
+	if resp.StatusCode != http.StatusUnauthorized {
+		return auth, nil
+	}
+
+	scheme, challenge := parseChallenge(resp.Header.Get("WWW-Authenticate"))
+	if !strings.EqualFold(scheme, "bearer") {
+		return auth, nil
+	}
+
+	realm, ok := challenge["realm"]
+	if !ok {
+		return auth, errors.New("authentication challenge did not contain a realm")
+	}
+
+	query := url.Values{}
+	query.Set("client_id", ClientID)
+	query.Set("offline_token", "true")
+
+	if service, ok := challenge["service"]; ok {
+		query.Set("service", service)
+	}
+
+	if repository != "" {
+		query.Set("scope", fmt.Sprintf("repository:%s:pull,push", repository))
+	}
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s?%s", realm, query.Encode()), nil)
+	if err != nil {
+		return auth, err
+	}
+
+	if auth.Username != "" {
+		req.SetBasicAuth(auth.Username, auth.Password)
+	}
+
+	resp, err = client.Do(req)
+	if err != nil {
+		return auth, fmt.Errorf("failed to request token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return auth, fmt.Errorf("token service returned status: %s", resp.Status)
+	}
+
+	var token tokenResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return auth, fmt.Errorf("failed to decode token: %w", err)
+	}
+
+	// A refresh token allows the daemon to request its own access tokens.
+	if token.RefreshToken != "" {
+		return docker.AuthConfiguration{
+			ServerAddress: auth.ServerAddress,
+			IdentityToken: token.RefreshToken,
+		}, nil
+	}
+
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+
+	if token.Token == "" {
+		return auth, errors.New("token service did not return a token")
+	}
+
+	return docker.AuthConfiguration{
+		ServerAddress: auth.ServerAddress,
+		RegistryToken: token.Token,
+	}, nil
+}
+
+// Helper function to parse a WWW-Authenticate header eg. Bearer realm="https://example.com/token",service="example.com".
+func parseChallenge(header string) (string, map[string]string) {
+	params := make(map[string]string)
+
+	parts := strings.SplitN(strings.TrimSpace(header), " ", 2)
+	if len(parts) != 2 {
+		return parts[0], params
+	}
+
+	rest := parts[1]
+
+	for rest != "" {
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+
+		var value string
+
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			end := strings.Index(rest, ",")
+			if end < 0 {
+				value, rest = rest, ""
+			} else {
+				value, rest = rest[:end], rest[end:]
+			}
+		}
+
+		params[key] = value
+		rest = strings.TrimLeft(rest, ", ")
+	}
+
+	return parts[0], params
+}
@@ -0,0 +1,82 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOAuth2(t *testing.T) {
+	var server *httptest.Server
+
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/service/token",service="harbor-registry"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/service/token":
+			username, password, _ := r.BasicAuth()
+			assert.Equal(t, "robot", username)
+			assert.Equal(t, "secret", password)
+			assert.Equal(t, "harbor-registry", r.URL.Query().Get("service"))
+			assert.Equal(t, "repository:project/app:pull,push", r.URL.Query().Get("scope"))
+			assert.Equal(t, ClientID, r.URL.Query().Get("client_id"))
+			fmt.Fprint(w, `{"token": "abc123"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	registry := fmt.Sprintf("%s/project/app", strings.TrimPrefix(server.URL, "https://"))
+
+	auth, err := OAuth2{Client: server.Client()}.Upgrade(context.Background(), registry, docker.AuthConfiguration{
+		Username: "robot",
+		Password: "secret",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, docker.AuthConfiguration{RegistryToken: "abc123"}, auth)
+}
+
+func TestOAuth2RefreshToken(t *testing.T) {
+	var server *httptest.Server
+
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/token":
+			assert.Equal(t, "true", r.URL.Query().Get("offline_token"))
+			fmt.Fprint(w, `{"access_token": "abc123", "refresh_token": "def456"}`)
+		}
+	}))
+	defer server.Close()
+
+	auth, err := OAuth2{Client: server.Client()}.Upgrade(context.Background(), strings.TrimPrefix(server.URL, "https://"), docker.AuthConfiguration{
+		Username: "robot",
+		Password: "secret",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, docker.AuthConfiguration{IdentityToken: "def456"}, auth)
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.example.com/token",service="registry.example.com",scope="repository:app:pull"`)
+	assert.Equal(t, "Bearer", scheme)
+	assert.Equal(t, map[string]string{
+		"realm":   "https://auth.example.com/token",
+		"service": "registry.example.com",
+		"scope":   "repository:app:pull",
+	}, params)
+
+	scheme, params = parseChallenge(`Basic realm=registry`)
+	assert.Equal(t, "Basic", scheme)
+	assert.Equal(t, map[string]string{"realm": "registry"}, params)
+}
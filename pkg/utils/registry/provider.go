@@ -0,0 +1,196 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	docker "github.com/fsouza/go-dockerclient"
+
+	"github.com/skpr/package/pkg/utils/aws/ecr"
+	"github.com/skpr/package/pkg/utils/azure/acr"
+	"github.com/skpr/package/pkg/utils/google/gar"
+)
+
+// Provider upgrades the credentials used to authenticate with a registry.
+type Provider interface {
+	// Name of the provider eg. "ecr".
+	Name() string
+	// Upgrade the credentials for the registry.
+	Upgrade(ctx context.Context, registry string, auth docker.AuthConfiguration) (docker.AuthConfiguration, error)
+}
+
+// Provisioner is implemented by providers which can create repositories.
+type Provisioner interface {
+	// EnsureRepository creates the repository if it does not exist. Returns true if it was created.
+	EnsureRepository(ctx context.Context, registry string, auth docker.AuthConfiguration) (bool, error)
+}
+
+// Exchanger is implemented by providers which exchange a login for a token eg. OAuth2, rather
+// than obtaining credentials from the environment. They are given credentials from the Docker config.
+type Exchanger interface {
+	// ExchangesLogin returns true if the provider requires a login to exchange.
+	ExchangesLogin() bool
+}
+
+// Providers selects a Provider based on the hostname of a registry.
+type Providers struct {
+	entries []entry
+}
+
+// entry pairs a hostname matcher with a provider.
+type entry struct {
+	match    func(hostname string) bool
+	provider Provider
+}
+
+// NewProviders creates an empty set of providers.
+func NewProviders() *Providers {
+	return &Providers{}
+}
+
+// DefaultProviders creates a set of providers for the well known registries.
+func DefaultProviders() *Providers {
+	p := NewProviders()
+
+	// ECR hostnames are matched with the same rules used to parse them, which a pattern cannot express.
+	p.RegisterFunc(ecr.IsRegistry, ecr.Provider{})
+
+	// The patterns below are static, so they cannot fail to register.
+	_ = p.Register("*-docker.pkg.dev", gar.Provider{})
+	_ = p.Register("*.azurecr.io", acr.Provider{})
+
+	return p
+}
+
+// Options for the providers created by name.
+type Options struct {
+	// ECR provider, configured eg. with an AWS profile or role.
+	ECR ecr.Provider
+}
+
+// New provider by name.
+func New(name string, options Options) (Provider, error) {
+	switch name {
+	case "ecr":
+		return options.ECR, nil
+	case "gar":
+		return gar.Provider{}, nil
+	case "acr":
+		return acr.Provider{}, nil
+	case "oauth2":
+		return OAuth2{}, nil
+	}
+
+	return nil, fmt.Errorf("provider not found: %s", name)
+}
+
+// Register a provider for hostnames matching a pattern eg. "*.azurecr.io".
+// Patterns use path.Match syntax and are evaluated in the order they were registered.
+func (p *Providers) Register(pattern string, provider Provider) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+
+	p.RegisterFunc(func(hostname string) bool {
+		ok, _ := path.Match(pattern, hostname)
+		return ok
+	}, provider)
+
+	return nil
+}
+
+// RegisterFunc registers a provider for hostnames which a function matches.
+// Functions are evaluated in the order they were registered, along with patterns.
+func (p *Providers) RegisterFunc(match func(hostname string) bool, provider Provider) {
+	p.entries = append(p.entries, entry{
+		match:    match,
+		provider: provider,
+	})
+}
+
+// Prepend a provider so it takes precedence over those already registered.
+func (p *Providers) Prepend(pattern string, provider Provider) error {
+	existing := p.entries
+	p.entries = nil
+
+	if err := p.Register(pattern, provider); err != nil {
+		p.entries = existing
+		return err
+	}
+
+	p.entries = append(p.entries, existing...)
+
+	return nil
+}
+
+// Replace the provider registered for each pattern with one of the same name eg. to configure the defaults.
+func (p *Providers) Replace(provider Provider) {
+	for i, e := range p.entries {
+		if e.provider.Name() == provider.Name() {
+			p.entries[i].provider = provider
+		}
+	}
+}
+
+// Lookup the provider for a registry.
+func (p *Providers) Lookup(registry string) (Provider, bool) {
+	hostname := Hostname(registry)
+
+	for _, e := range p.entries {
+		if e.match(hostname) {
+			return e.provider, true
+		}
+	}
+
+	return nil, false
+}
+
+// Upgrade the credentials for a registry. Credentials are returned unchanged when no provider matches.
+func (p *Providers) Upgrade(ctx context.Context, registry string, auth docker.AuthConfiguration) (docker.AuthConfiguration, error) {
+	provider, ok := p.Lookup(registry)
+	if !ok {
+		return auth, nil
+	}
+
+	upgraded, err := provider.Upgrade(ctx, registry, auth)
+	if err != nil {
+		return auth, fmt.Errorf("%s: %w", provider.Name(), err)
+	}
+
+	return upgraded, nil
+}
+
+// DockerHub is the hostname of references which do not include a registry eg. "skpr/app".
+const DockerHub = "docker.io"
+
+// Hostname of a registry eg. "example.com" for "example.com/project/app", or DockerHub for "skpr/app".
+func Hostname(registry string) string {
+	parts := strings.SplitN(registry, "/", 2)
+	if !isHostname(parts[0]) {
+		return DockerHub
+	}
+
+	return parts[0]
+}
+
+// Repository of a registry eg. "project/app" for "example.com/project/app".
+func Repository(registry string) string {
+	parts := strings.SplitN(registry, "/", 2)
+	if !isHostname(parts[0]) {
+		return registry
+	}
+
+	if len(parts) != 2 {
+		return ""
+	}
+
+	return parts[1]
+}
+
+// Helper function to determine whether the first component of a reference is a hostname,
+// using the same rules as Docker eg. "skpr" in "skpr/app" is part of a Docker Hub repository.
+func isHostname(component string) bool {
+	return strings.ContainsAny(component, ".:") || component == "localhost"
+}
@@ -0,0 +1,116 @@
+package registry
+
+import (
+	"context"
+	"testing"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skpr/package/pkg/utils/aws/ecr"
+)
+
+type mockProvider struct {
+	name string
+	// configured distinguishes a replacement from the provider it replaced.
+	configured bool
+}
+
+func (p mockProvider) Name() string {
+	return p.name
+}
+
+func (p mockProvider) Upgrade(ctx context.Context, registry string, auth docker.AuthConfiguration) (docker.AuthConfiguration, error) {
+	auth.Password = p.name
+	return auth, nil
+}
+
+func TestLookup(t *testing.T) {
+	providers := DefaultProviders()
+
+	provider, ok := providers.Lookup("123456789012.dkr.ecr.ap-southeast-2.amazonaws.com/app")
+	assert.True(t, ok)
+	assert.Equal(t, "ecr", provider.Name())
+
+	provider, ok = providers.Lookup("australia-southeast1-docker.pkg.dev/project/app")
+	assert.True(t, ok)
+	assert.Equal(t, "gar", provider.Name())
+
+	provider, ok = providers.Lookup("example.azurecr.io/app")
+	assert.True(t, ok)
+	assert.Equal(t, "acr", provider.Name())
+
+	provider, ok = providers.Lookup("123456789012.dkr-ecr-fips.us-east-1.on.aws/app")
+	assert.True(t, ok)
+	assert.Equal(t, "ecr", provider.Name())
+
+	_, ok = providers.Lookup("docker.io/skpr/app")
+	assert.False(t, ok)
+
+	// Hosts which only resemble ECR are not matched.
+	_, ok = providers.Lookup("foo.dkr.ecr.example.com/app")
+	assert.False(t, ok)
+
+	assert.NoError(t, providers.Prepend("*.azurecr.io", mockProvider{name: "mock"}))
+
+	provider, ok = providers.Lookup("example.azurecr.io/app")
+	assert.True(t, ok)
+	assert.Equal(t, "mock", provider.Name())
+
+	assert.Error(t, providers.Register("[", mockProvider{}))
+}
+
+func TestReplace(t *testing.T) {
+	providers := NewProviders()
+	assert.NoError(t, providers.Register("harbor.example.com", mockProvider{name: "mock"}))
+	assert.NoError(t, providers.Register("*.azurecr.io", mockProvider{name: "other"}))
+
+	providers.Replace(mockProvider{name: "mock", configured: true})
+
+	provider, ok := providers.Lookup("harbor.example.com/project/app")
+	assert.True(t, ok)
+	assert.Equal(t, mockProvider{name: "mock", configured: true}, provider)
+
+	provider, ok = providers.Lookup("example.azurecr.io/app")
+	assert.True(t, ok)
+	assert.Equal(t, mockProvider{name: "other"}, provider)
+}
+
+func TestNew(t *testing.T) {
+	provider, err := New("ecr", Options{ECR: ecr.Provider{Profile: "prod", RoleARN: "arn:aws:iam::123456789012:role/push"}})
+	assert.NoError(t, err)
+	assert.Equal(t, ecr.Provider{Profile: "prod", RoleARN: "arn:aws:iam::123456789012:role/push"}, provider)
+
+	provider, err = New("oauth2", Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, "oauth2", provider.Name())
+
+	_, err = New("unknown", Options{})
+	assert.EqualError(t, err, "provider not found: unknown")
+}
+
+func TestUpgrade(t *testing.T) {
+	providers := NewProviders()
+	assert.NoError(t, providers.Register("harbor.example.com", mockProvider{name: "mock"}))
+
+	auth, err := providers.Upgrade(context.Background(), "harbor.example.com/project/app", docker.AuthConfiguration{Username: "user"})
+	assert.NoError(t, err)
+	assert.Equal(t, docker.AuthConfiguration{Username: "user", Password: "mock"}, auth)
+
+	auth, err = providers.Upgrade(context.Background(), "docker.io/skpr/app", docker.AuthConfiguration{Username: "user"})
+	assert.NoError(t, err)
+	assert.Equal(t, docker.AuthConfiguration{Username: "user"}, auth)
+}
+
+func TestHostname(t *testing.T) {
+	assert.Equal(t, "example.com", Hostname("example.com/project/app"))
+	assert.Equal(t, "example.com", Hostname("example.com"))
+	assert.Equal(t, "project/app", Repository("example.com/project/app"))
+	assert.Equal(t, "", Repository("example.com"))
+	assert.Equal(t, "localhost", Hostname("localhost/app"))
+	assert.Equal(t, "localhost:5000", Hostname("localhost:5000/app"))
+	assert.Equal(t, DockerHub, Hostname("skpr/app"))
+	assert.Equal(t, "skpr/app", Repository("skpr/app"))
+	assert.Equal(t, DockerHub, Hostname("app"))
+	assert.Equal(t, "app", Repository("app"))
+}